@@ -1,7 +1,15 @@
 package cmd
 
-import "github.com/vspaz/slow_cooker/internal/generator"
+import (
+	"github.com/vspaz/slow_cooker/internal/generator"
+	"github.com/vspaz/slow_cooker/internal/recorder"
+	"os"
+)
 
 func Run() {
+	if len(os.Args) > 1 && os.Args[1] == "record" {
+		recorder.Run(os.Args[2:])
+		return
+	}
 	generator.Run()
 }
@@ -0,0 +1,273 @@
+package accesslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/reqspec"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLineSize bounds the length of a line.
+const maxLineSize = 1024 * 1024
+
+// commonTime is the time layout of the common and combined log formats.
+const commonTime = "02/Jan/2006:15:04:05 -0700"
+
+// combined matches a line of the common log format, optionally followed by
+// the referer and user agent of the combined log format, e.g.
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /a.gif HTTP/1.0" 200 2326 "http://a.test/" "Mozilla/4.08"
+var combined = regexp.MustCompile(`^\S+ \S+ .*?\[([^\]]+)\] "((?:[^"\\]|\\.)*)" \S+ \S+(?: "(?:[^"\\]|\\.)*" "((?:[^"\\]|\\.)*)")?`)
+
+// JSON fields the time, method, path, request line and user agent are read
+// from, in order of preference.
+var (
+	timeFields      = []string{"time", "timestamp", "@timestamp", "time_iso8601", "time_local", "msec"}
+	methodFields    = []string{"method", "request_method"}
+	pathFields      = []string{"path", "uri", "request_uri", "url"}
+	requestFields   = []string{"request"}
+	userAgentFields = []string{"user_agent", "http_user_agent", "userAgent"}
+)
+
+// Load reads the access log at path and returns its requests sent to base
+// in the order they were logged, with the time each was logged at relative
+// to the first one. It also returns the number of lines left out because
+// they don't hold a valid HTTP request, e.g. after a client sent garbage.
+func Load(path string, base string) ([]reqspec.Request, []time.Duration, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer file.Close()
+	return Parse(path, file, base)
+}
+
+// Parse reads the access log of the given name from r. Lines are written in
+// the common or combined log format of nginx and Apache, or are JSON
+// objects. Blank lines are skipped. All lines that can't be read are
+// reported together, each prefixed with the file name and line number.
+func Parse(name string, r io.Reader, base string) ([]reqspec.Request, []time.Duration, int, error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+
+	type entry struct {
+		request reqspec.Request
+		logged  time.Time
+	}
+	var entries []entry
+	var errs []error
+	skipped := 0
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var l logLine
+		if text[0] == '{' {
+			l, err = parseJSON(text)
+		} else {
+			l, err = parseCommon(string(text))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %s", name, line, err))
+			continue
+		}
+		request, ok := l.request(baseURL)
+		if !ok {
+			skipped++
+			continue
+		}
+		entries = append(entries, entry{request, l.logged})
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %s", name, err))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, 0, err
+	}
+	if len(entries) == 0 {
+		return nil, nil, 0, fmt.Errorf("%s: the file has no requests", name)
+	}
+
+	// Servers log requests when they complete, so the log isn't quite in
+	// the order they arrived in.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].logged.Before(entries[j].logged)
+	})
+	requests := make([]reqspec.Request, len(entries))
+	offsets := make([]time.Duration, len(entries))
+	for i, entry := range entries {
+		requests[i] = entry.request
+		offsets[i] = entry.logged.Sub(entries[0].logged)
+	}
+	return requests, offsets, skipped, nil
+}
+
+// logLine is what is replayed of a line.
+type logLine struct {
+	logged    time.Time
+	method    string
+	target    string
+	userAgent string
+}
+
+// request returns the request of the line sent to base, or false if the line
+// doesn't hold a valid HTTP request.
+func (l logLine) request(base *url.URL) (reqspec.Request, bool) {
+	if l.method == "" || strings.ContainsAny(l.method, "()<>@,;:\\\"/[]?={} \t") {
+		return reqspec.Request{}, false
+	}
+	target, err := url.ParseRequestURI(l.target)
+	if err != nil {
+		return reqspec.Request{}, false
+	}
+	// Proxies log absolute URLs, of which only the path is replayed.
+	replayed := *base
+	replayed.Path = strings.TrimSuffix(base.Path, "/") + target.Path
+	replayed.RawPath = ""
+	if target.RawPath != "" {
+		replayed.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + target.RawPath
+	}
+	replayed.RawQuery = target.RawQuery
+
+	request := reqspec.Request{
+		Method: l.method,
+		URL:    replayed.String(),
+		Header: make(http.Header),
+		// Access logs don't hold bodies, which are never inherited from
+		// -data.
+		Body:   []byte{},
+		Weight: 1,
+	}
+	if l.userAgent != "" && l.userAgent != "-" {
+		request.Header.Set("User-Agent", l.userAgent)
+	}
+	return request, true
+}
+
+func parseCommon(text string) (logLine, error) {
+	match := combined.FindStringSubmatch(text)
+	if match == nil {
+		return logLine{}, errors.New("not in the common or combined log format")
+	}
+	logged, err := time.Parse(commonTime, match[1])
+	if err != nil {
+		return logLine{}, fmt.Errorf("invalid time '%s'", match[1])
+	}
+	l := logLine{logged: logged, userAgent: unescape(match[3])}
+	l.method, l.target = splitRequestLine(unescape(match[2]))
+	return l, nil
+}
+
+func parseJSON(text []byte) (logLine, error) {
+	var fields map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return logLine{}, err
+	}
+
+	var l logLine
+	name, value := lookup(fields, timeFields)
+	if name == "" {
+		return logLine{}, fmt.Errorf("no time field, expected one of %s", strings.Join(timeFields, ", "))
+	}
+	logged, err := parseTime(value)
+	if err != nil {
+		return logLine{}, fmt.Errorf("invalid %s '%v'", name, value)
+	}
+	l.logged = logged
+	if _, path := lookup(fields, pathFields); path != nil {
+		_, method := lookup(fields, methodFields)
+		l.method, _ = method.(string)
+		l.target, _ = path.(string)
+	} else if _, request := lookup(fields, requestFields); request != nil {
+		line, _ := request.(string)
+		l.method, l.target = splitRequestLine(line)
+	} else {
+		return logLine{}, fmt.Errorf("no path field, expected one of %s", strings.Join(append(pathFields, requestFields...), ", "))
+	}
+	if _, userAgent := lookup(fields, userAgentFields); userAgent != nil {
+		l.userAgent, _ = userAgent.(string)
+	}
+	return l, nil
+}
+
+// lookup returns the first of names set in fields, and its value.
+func lookup(fields map[string]interface{}, names []string) (string, interface{}) {
+	for _, name := range names {
+		if value, ok := fields[name]; ok && value != nil {
+			return name, value
+		}
+	}
+	return "", nil
+}
+
+// parseTime parses an RFC 3339 time, a time in the common log format, or a
+// Unix time in seconds, e.g. nginx's $msec.
+func parseTime(value interface{}) (time.Time, error) {
+	switch value := value.(type) {
+	case json.Number:
+		return unixTime(string(value))
+	case string:
+		if logged, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return logged, nil
+		}
+		if logged, err := time.Parse(commonTime, value); err == nil {
+			return logged, nil
+		}
+		return unixTime(value)
+	}
+	return time.Time{}, errors.New("invalid time")
+}
+
+func unixTime(text string) (time.Time, error) {
+	seconds, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)).UTC(), nil
+}
+
+// splitRequestLine returns the method and target of a request line such as
+// "GET /index.html HTTP/1.1", or empty strings if it isn't one.
+func splitRequestLine(line string) (string, string) {
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/") {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// unescape undoes the escaping of double quotes and backslashes in quoted
+// fields.
+func unescape(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) && (text[i+1] == '"' || text[i+1] == '\\') {
+			i++
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
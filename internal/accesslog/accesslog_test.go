@@ -0,0 +1,69 @@
+package accesslog
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vspaz/slow_cooker/internal/reqspec"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCombinedLog(t *testing.T) {
+	requests, offsets, skipped, err := Parse("access.log", strings.NewReader(`
+10.0.0.1 - - [01/Mar/2024:10:00:01 +0000] "POST /cart?id=1 HTTP/1.1" 201 12 "https://shop.test/" "curl/8.0 \"beta\""
+10.0.0.2 - frank [01/Mar/2024:10:00:00 +0000] "GET /index.html HTTP/1.1" 200 2326
+10.0.0.3 - - [01/Mar/2024:10:00:02 +0000] "\x16\x03\x01" 400 150 "-" "-"
+10.0.0.4 - - [01/Mar/2024:11:00:03 +0100] "GET http://shop.test/a%2Fb HTTP/1.1" 200 1 "-" "-"
+`), "http://staging.test:8080/v2/")
+	require.NoError(t, err)
+	assert.Equal(t, []reqspec.Request{
+		{Method: "GET", URL: "http://staging.test:8080/v2/index.html", Header: http.Header{}, Body: []byte{}, Weight: 1},
+		{
+			Method: "POST",
+			URL:    "http://staging.test:8080/v2/cart?id=1",
+			Header: http.Header{"User-Agent": {`curl/8.0 "beta"`}},
+			Body:   []byte{},
+			Weight: 1,
+		},
+		{Method: "GET", URL: "http://staging.test:8080/v2/a%2Fb", Header: http.Header{}, Body: []byte{}, Weight: 1},
+	}, requests)
+	assert.Equal(t, []time.Duration{0, time.Second, 3 * time.Second}, offsets)
+	assert.Equal(t, 1, skipped)
+}
+
+func TestParseJSONLog(t *testing.T) {
+	requests, offsets, skipped, err := Parse("access.log", strings.NewReader(`
+{"time": "2024-03-01T10:00:00.5Z", "method": "GET", "path": "/a", "user_agent": "k6"}
+{"msec": 1709287200.75, "request": "DELETE /b HTTP/2.0"}
+{"time_local": "01/Mar/2024:10:00:01 +0000", "request_method": "PUT", "request_uri": "/c"}
+`), "http://staging.test")
+	require.NoError(t, err)
+	assert.Equal(t, []reqspec.Request{
+		{Method: "GET", URL: "http://staging.test/a", Header: http.Header{"User-Agent": {"k6"}}, Body: []byte{}, Weight: 1},
+		{Method: "DELETE", URL: "http://staging.test/b", Header: http.Header{}, Body: []byte{}, Weight: 1},
+		{Method: "PUT", URL: "http://staging.test/c", Header: http.Header{}, Body: []byte{}, Weight: 1},
+	}, requests)
+	assert.Equal(t, []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond}, offsets)
+	assert.Equal(t, 0, skipped)
+}
+
+func TestParseLogErrors(t *testing.T) {
+	_, _, _, err := Parse("access.log", strings.NewReader(`hello
+10.0.0.1 - - [yesterday] "GET / HTTP/1.1" 200 1
+{"method": "GET", "path": "/"}
+{"time": "soon", "path": "/"}
+{"time": "2024-03-01T10:00:00Z", "method": "GET"}
+{"time":
+`), "http://staging.test")
+	assert.EqualError(t, err, `access.log:1: not in the common or combined log format
+access.log:2: invalid time 'yesterday'
+access.log:3: no time field, expected one of time, timestamp, @timestamp, time_iso8601, time_local, msec
+access.log:4: invalid time 'soon'
+access.log:5: no path field, expected one of path, uri, request_uri, url, request
+access.log:6: unexpected EOF`)
+
+	_, _, _, err = Parse("access.log", strings.NewReader(`10.0.0.1 - - [01/Mar/2024:10:00:01 +0000] "-" 400 0 "-" "-"`), "http://staging.test")
+	assert.EqualError(t, err, "access.log: the file has no requests")
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Provider sets the credentials of every request of a run. It is safe to use
+// concurrently.
+type Provider interface {
+	// Authorize sets the credentials of req, or returns why it can't.
+	Authorize(req *http.Request) error
+	// String describes the provider in the request info.
+	String() string
+}
+
+// Basic authenticates requests with HTTP basic authentication.
+type Basic struct {
+	user     string
+	password string
+}
+
+// NewBasic returns a provider of HTTP basic authentication with the
+// credentials written as USER:PASSWORD.
+func NewBasic(credentials string) (*Basic, error) {
+	user, password, ok := strings.Cut(credentials, ":")
+	if !ok || user == "" {
+		return nil, errors.New("expected USER:PASSWORD")
+	}
+	return &Basic{user: user, password: password}, nil
+}
+
+func (b *Basic) Authorize(req *http.Request) error {
+	req.SetBasicAuth(b.user, b.password)
+	return nil
+}
+
+func (b *Basic) String() string {
+	return fmt.Sprintf("basic authentication as %s", b.user)
+}
+
+// Bearer authenticates requests with a static bearer token.
+type Bearer struct {
+	path  string
+	token string
+}
+
+// LoadBearer reads the bearer token in the file at path, ignoring the
+// whitespace around it.
+func LoadBearer(path string) (*Bearer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("%s: the file is empty", path)
+	}
+	return &Bearer{path: path, token: token}, nil
+}
+
+func (b *Bearer) Authorize(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	return nil
+}
+
+func (b *Bearer) String() string {
+	return fmt.Sprintf("bearer token from %s", b.path)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBasicOk(t *testing.T) {
+	b, err := NewBasic("alice:s3cr:t")
+	require.NoError(t, err)
+	req := httptest.NewRequest("GET", "http://a.test/", nil)
+	assert.NoError(t, b.Authorize(req))
+	user, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "alice", user)
+	assert.Equal(t, "s3cr:t", password)
+
+	_, err = NewBasic("alice")
+	assert.EqualError(t, err, "expected USER:PASSWORD")
+}
+
+func TestBearerOk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("abc\n"), 0o600))
+	b, err := LoadBearer(path)
+	require.NoError(t, err)
+	req := httptest.NewRequest("GET", "http://a.test/", nil)
+	assert.NoError(t, b.Authorize(req))
+	assert.Equal(t, "Bearer abc", req.Header.Get("Authorization"))
+
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0o600))
+	_, err = LoadBearer(path)
+	assert.EqualError(t, err, path+": the file is empty")
+}
+
+func TestOAuth2RefreshesTokens(t *testing.T) {
+	var mu sync.Mutex
+	var forms []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		user, password, _ := req.BasicAuth()
+		req.ParseForm()
+		forms = append(forms, user+":"+password+" "+req.PostForm.Encode())
+		if len(forms) == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"access_token": "t` + string(rune('0'+len(forms))) + `", "token_type": "Bearer", "expires_in": 1}`))
+	}))
+	defer server.Close()
+
+	o, err := NewOAuth2(server.URL, "app", "secret", "read", time.Second)
+	require.NoError(t, err)
+	defer o.Stop()
+	req := httptest.NewRequest("GET", "http://a.test/", nil)
+	require.NoError(t, o.Authorize(req))
+	assert.Equal(t, "Bearer t1", req.Header.Get("Authorization"))
+
+	// The refresh after 900ms fails and is retried a second later, after
+	// the first token expired.
+	time.Sleep(1500 * time.Millisecond)
+	err = o.Authorize(req)
+	assert.EqualError(t, err, "no valid OAuth2 token: token endpoint returned 503 Service Unavailable")
+	assert.ErrorIs(t, err, ErrNoToken)
+	time.Sleep(time.Second)
+	require.NoError(t, o.Authorize(req))
+	assert.Equal(t, "Bearer t3", req.Header.Get("Authorization"))
+
+	stats := o.Stats()
+	assert.Equal(t, uint64(3), stats.Fetches)
+	assert.Equal(t, uint64(1), stats.Failures)
+	assert.Equal(t, uint64(1), stats.Skipped)
+	assert.Equal(t, int64(3), stats.Latency.TotalCount())
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "app:secret grant_type=client_credentials&scope=read", forms[0])
+}
+
+func TestNewOAuth2Errors(t *testing.T) {
+	_, err := NewOAuth2("localhost/token", "app", "", "", time.Second)
+	assert.EqualError(t, err, "invalid token URL 'localhost/token'")
+	_, err = NewOAuth2("http://localhost/token", "", "", "", time.Second)
+	assert.EqualError(t, err, "a client ID is required")
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// Delays between attempts to fetch a token after a failure, doubled after
+// every failure in a row.
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = 30 * time.Second
+)
+
+// ErrNoToken is returned by Authorize when there is no valid token to send a
+// request with. Such requests are counted apart from those of the workload.
+var ErrNoToken = errors.New("no valid OAuth2 token")
+
+// OAuth2 authenticates requests with bearer tokens fetched from a token
+// endpoint with the OAuth2 client credentials grant. Tokens are fetched in
+// the background and refreshed before they expire, and fetches that fail are
+// retried, so requests are never held up by a refresh.
+type OAuth2 struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scope        string
+	client       *http.Client
+
+	start sync.Once
+	// fetched is closed once the first fetch is over, successful or not.
+	fetched chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu      sync.RWMutex
+	token   string
+	expiry  time.Time
+	lastErr error
+
+	stats TokenStats
+	// skipped counts the requests Authorize found no valid token for.
+	skipped atomic.Uint64
+}
+
+// TokenStats are the outcomes and latencies of the token fetches of an
+// OAuth2 provider, kept apart from those of the workload.
+type TokenStats struct {
+	Fetches  uint64
+	Failures uint64
+	// Skipped is the number of requests that weren't sent for lack of a
+	// valid token.
+	Skipped uint64
+	// Latency holds the latencies of the fetches in microseconds.
+	Latency *hdrhistogram.Histogram
+}
+
+// NewOAuth2 returns a provider fetching tokens for the given client, and
+// scope if not empty, from tokenURL, waiting up to timeout for each fetch.
+func NewOAuth2(tokenURL, clientID, clientSecret, scope string, timeout time.Duration) (*OAuth2, error) {
+	URL, err := url.Parse(tokenURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token URL '%s': %s", tokenURL, err)
+	}
+	if URL.Scheme == "" || URL.Host == "" {
+		return nil, fmt.Errorf("invalid token URL '%s'", tokenURL)
+	}
+	if clientID == "" {
+		return nil, errors.New("a client ID is required")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &OAuth2{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scope:        scope,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+		fetched: make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		stats:   TokenStats{Latency: hdrhistogram.New(0, (24 * time.Hour).Microseconds(), 3)},
+	}, nil
+}
+
+// Authorize sets the current token on req. The first call starts fetching
+// tokens and waits for the first one.
+func (o *OAuth2) Authorize(req *http.Request) error {
+	o.start.Do(func() {
+		go o.refresh()
+	})
+	select {
+	case <-o.fetched:
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.token == "" || (!o.expiry.IsZero() && time.Now().After(o.expiry)) {
+		o.skipped.Add(1)
+		return fmt.Errorf("%w: %s", ErrNoToken, o.lastErr)
+	}
+	req.Header.Set("Authorization", "Bearer "+o.token)
+	return nil
+}
+
+func (o *OAuth2) String() string {
+	return fmt.Sprintf("OAuth2 client credentials of %s from %s", o.clientID, o.tokenURL)
+}
+
+// Stop stops refreshing tokens.
+func (o *OAuth2) Stop() {
+	o.cancel()
+}
+
+// Stats returns a copy of the stats of the token fetches so far.
+func (o *OAuth2) Stats() TokenStats {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	stats := o.stats
+	stats.Skipped = o.skipped.Load()
+	stats.Latency = hdrhistogram.Import(o.stats.Latency.Export())
+	return stats
+}
+
+// refresh fetches a token, then a new one before it expires, until stopped.
+func (o *OAuth2) refresh() {
+	retryDelay := minRetryDelay
+	first := true
+	for {
+		lifetime, err := o.fetch()
+		if first {
+			close(o.fetched)
+			first = false
+		}
+		var wait time.Duration
+		if err != nil {
+			wait = retryDelay
+			retryDelay = min(2*retryDelay, maxRetryDelay)
+		} else if lifetime == 0 {
+			// The token never expires.
+			return
+		} else {
+			wait = refreshDelay(lifetime)
+			retryDelay = minRetryDelay
+		}
+		select {
+		case <-time.After(wait):
+		case <-o.ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshDelay returns how long to wait before refreshing a token that
+// expires after lifetime: once 90% of it has passed, so that requests are
+// still sent with the current token if the refresh takes a while or fails a
+// few times.
+func refreshDelay(lifetime time.Duration) time.Duration {
+	return lifetime * 9 / 10
+}
+
+// tokenResponse is the response of a token endpoint, see RFC 6749 5.1.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// fetch fetches a new token, and returns its lifetime, zero if it doesn't
+// expire.
+func (o *OAuth2) fetch() (time.Duration, error) {
+	start := time.Now()
+	token, err := o.request()
+	elapsed := time.Since(start)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stats.Fetches++
+	o.stats.Latency.RecordValue(elapsed.Microseconds())
+	if err != nil {
+		o.stats.Failures++
+		o.lastErr = err
+		return 0, err
+	}
+	lifetime := time.Duration(token.ExpiresIn) * time.Second
+	o.token = token.AccessToken
+	o.expiry = time.Time{}
+	if lifetime > 0 {
+		o.expiry = start.Add(lifetime)
+	}
+	return lifetime, nil
+}
+
+func (o *OAuth2) request() (*tokenResponse, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if o.scope != "" {
+		form.Set("scope", o.scope)
+	}
+	req, err := http.NewRequestWithContext(o.ctx, http.MethodPost, o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(o.clientID), url.QueryEscape(o.clientSecret))
+	response, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("token endpoint returned %s", response.Status)
+	}
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("invalid token response: %s", err)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("invalid token response: no access_token")
+	}
+	if token.TokenType != "" && !strings.EqualFold(token.TokenType, "bearer") {
+		return nil, fmt.Errorf("unsupported token type '%s'", token.TokenType)
+	}
+	return &token, nil
+}
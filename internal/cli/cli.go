@@ -3,6 +3,19 @@ package cli
 import (
 	"flag"
 	"fmt"
+	"github.com/vspaz/slow_cooker/internal/accesslog"
+	"github.com/vspaz/slow_cooker/internal/auth"
+	"github.com/vspaz/slow_cooker/internal/feeder"
+	"github.com/vspaz/slow_cooker/internal/flow"
+	"github.com/vspaz/slow_cooker/internal/form"
+	"github.com/vspaz/slow_cooker/internal/har"
+	"github.com/vspaz/slow_cooker/internal/pacer"
+	"github.com/vspaz/slow_cooker/internal/plan"
+	"github.com/vspaz/slow_cooker/internal/reqspec"
+	"github.com/vspaz/slow_cooker/internal/search"
+	"github.com/vspaz/slow_cooker/internal/signing"
+	"github.com/vspaz/slow_cooker/internal/weighted"
+	"net/http"
 	"os"
 	"path"
 	"strings"
@@ -13,49 +26,229 @@ type Args struct {
 	Qps              int
 	Concurrency      int
 	IterationCount   uint64
+	Warmup           time.Duration
+	WarmupIterations uint64
 	Host             []string
+	HostWeights      []float64
 	Method           string
 	Interval         time.Duration
 	NoReuse          bool
 	Compress         bool
 	ClientTimeout    time.Duration
+	DrainTimeout     time.Duration
 	NoLatencySummary bool
 	ReportLatencyCsv string
 	LatencyUnit      string
 	LatencyDuration  time.Duration
 	Help             bool
 	TotalRequests    uint64
-	Headers          map[string]string
+	Headers          http.Header
+	Auth             auth.Provider
+	Signer           signing.Signer
 	Data             []byte
+	Form             *form.Form
 	MetricAddr       string
 	HashValue        uint64
 	HashSampleRate   float64
+	OpenLoop         bool
+	Templates        bool
+	Feeder           *feeder.Feeder
+	RateProfile      pacer.Profile
+	Arrival          pacer.Arrival
+	Seed             int64
+	Search           search.Strategy
+	SloP99           int64
+	SloErrorRate     float64
+	Plan             []plan.Stage
+	Scenarios        []plan.Stage
+	Flow             []flow.Step
 	DstUrls          []string
+	UrlOrder         string
+	// Requests, if set, are the requests of -requests, -har or -accessLog,
+	// sent in place of DstUrls which holds their URLs.
+	Requests []reqspec.Request
+	// Timeline, if set, holds the time of each of the Requests relative to
+	// the first one, to replay them with their recorded timing, already
+	// divided by ReplaySpeed.
+	Timeline    []time.Duration
+	ReplaySpeed float64
+	// UrlSource, DataSource, HeaderSource, HeaderFile and RequestsFile are
+	// the target URL argument and the -data, -headers, -headerFile and
+	// -requests flags that DstUrls, Data, Headers and Requests were loaded
+	// from, kept to reload them. StageHeaders are the headers that the stage
+	// of a plan or scenario sets over those of the flags.
+	UrlSource    string
+	DataSource   string
+	HeaderSource string
+	HeaderFile   string
+	StageHeaders http.Header
+	RequestsFile string
+	// HarFile, AccessLogFile and FlowFile are the -har, -accessLog and -flow
+	// flags, which aren't reloaded. SkippedLines counts the lines of the
+	// access log that were left out because they don't hold a valid request.
+	HarFile       string
+	AccessLogFile string
+	FlowFile      string
+	SkippedLines  int
+	// Cookies gives every request thread its own cookie jar, as a virtual
+	// user. UserSetup and UserTeardown are the steps each of them sends
+	// before its first request and once it stops.
+	Cookies      bool
+	UserSetup    []flow.Step
+	UserTeardown []flow.Step
+}
+
+// SessionValues returns the names of the values extracted by -userSetup,
+// which the templates of the requests of its virtual users can refer to.
+func (args *Args) SessionValues() []string {
+	return flow.Values(args.UserSetup, len(args.UserSetup))
+}
+
+// Reload reads DstUrls, Requests, Data and Headers again from the files they
+// were loaded from, if any, and returns the files that were read. The standard
+// input can't be read twice and is skipped, as are requests replayed with
+// their recorded timing. Nothing is changed if any fails to load.
+func (args *Args) Reload() ([]string, error) {
+	var files []string
+	urls := args.DstUrls
+	requests := args.Requests
+	if args.RequestsFile != "" && args.Timeline == nil {
+		var err error
+		if requests, err = reqspec.Load(args.RequestsFile); err != nil {
+			return nil, err
+		}
+		urls = requestURLs(requests)
+		files = append(files, args.RequestsFile)
+	} else if isReloadable(args.UrlSource) {
+		var err error
+		if urls, err = readURLs(args.UrlSource); err != nil {
+			return nil, err
+		}
+		if len(urls) == 0 {
+			return nil, fmt.Errorf("%s: no urls", args.UrlSource[1:])
+		}
+		files = append(files, args.UrlSource[1:])
+	}
+	data := args.Data
+	if isReloadable(args.DataSource) {
+		var err error
+		if data, err = readBody(args.DataSource); err != nil {
+			return nil, err
+		}
+		files = append(files, args.DataSource[1:])
+	}
+	headers := args.Headers
+	if args.HeaderFile != "" {
+		var err error
+		if headers, err = loadHeaders(args.HeaderSource, args.HeaderFile); err != nil {
+			return nil, err
+		}
+		for name, values := range args.StageHeaders {
+			headers[name] = values
+		}
+		files = append(files, args.HeaderFile)
+	}
+	if args.Templates {
+		columns := args.Feeder.Columns()
+		checked := urls
+		if args.Flow != nil {
+			// The URLs of the steps of a flow may refer to extracted
+			// values and aren't reloaded.
+			checked = nil
+		}
+		values := args.SessionValues()
+		if err := checkTemplates(checked, headers, data, columns, values); err != nil {
+			return nil, err
+		}
+		if err := checkRequestTemplates(requests, columns, values); err != nil {
+			return nil, err
+		}
+	}
+	args.DstUrls = urls
+	args.Requests = requests
+	args.Data = data
+	args.Headers = headers
+	return files, nil
+}
+
+func isReloadable(source string) bool {
+	return strings.HasPrefix(source, "@") && source != "@-"
 }
 
 func GetArgs() Args {
 	qps := flag.Int("qps", 1, "QPS to send to backends per request thread")
+	rate := flag.Float64("rate", 0, "total requests per second to send across all request threads, may be fractional (overrides -qps)")
 	concurrency := flag.Int("concurrency", 1, "Number of request threads")
 	iterationCount := flag.Uint64("iterations", 0, "Number of iterations (0 for infinite)")
-	host := flag.String("host", "", "value of Host header to set")
+	warmup := flag.Duration("warmup", 0, "warmup period excluded from the final summary, metrics and CSV report, rounded up to whole intervals")
+	warmupIterations := flag.Uint64("warmupIterations", 0, "number of warmup intervals excluded from the final summary, metrics and CSV report")
+	host := flag.String("host", "", "value of Host header to set, or a comma separated list of values to pick at random, optionally weighted, e.g. web_a=1,web_b=2")
 	method := flag.String("method", "POST", "HTTP method to use")
 	interval := flag.Duration("interval", 10*time.Second, "reporting interval")
 	noreuse := flag.Bool("noreuse", false, "don't reuse connections")
 	compress := flag.Bool("compress", false, "use compression")
 	clientTimeout := flag.Duration("timeout", 10*time.Second, "individual request timeout")
+	drainTimeout := flag.Duration("drainTimeout", 5*time.Second, "how long to wait for requests in flight when the run ends before abandoning them")
 	noLatencySummary := flag.Bool("noLatencySummary", false, "suppress the final latency summary")
 	reportLatenciesCSV := flag.String("reportLatenciesCSV", "", "filename to output hdrhistogram latencies in CSV")
 	latencyUnit := flag.String("latencyUnit", "ms", "latency units [ms|us|ns]")
 	help := flag.Bool("help", false, "show help message")
 	totalRequests := flag.Uint64("totalRequests", 0, "total number of requests to send before exiting")
 	headerString := flag.String("headers", "", "HTTP request headers separated by a comma, e.g. \"Content-Type: application/json\"")
+	headerFile := flag.String("headerFile", "", "file holding HTTP request headers, one \"Name: value\" per line, added to -headers; names can be repeated and values hold commas")
 	data := flag.String("data", "", "HTTP request data")
+	var formFields repeatedFlag
+	flag.Var(&formFields, "form", "field of a form sent as the request body, as NAME=VALUE, or NAME=@PATH to upload a file; can be repeated")
+	formEncoding := flag.String("formEncoding", "", "encoding of the -form body, multipart if it uploads files and urlencoded otherwise by default [multipart | urlencoded]")
+	basicAuth := flag.String("basicAuth", "", "authenticate requests with HTTP basic authentication, as USER:PASSWORD")
+	bearerTokenFile := flag.String("bearerTokenFile", "", "file holding a bearer token to authenticate requests with")
+	oauth2TokenUrl := flag.String("oauth2TokenUrl", "", "token endpoint to fetch OAuth2 tokens from with the client credentials grant, refreshed before they expire")
+	oauth2ClientId := flag.String("oauth2ClientId", "", "client ID of -oauth2TokenUrl")
+	oauth2ClientSecret := flag.String("oauth2ClientSecret", "", "client secret of -oauth2TokenUrl, or @file to read it from")
+	oauth2Scope := flag.String("oauth2Scope", "", "space separated scopes to ask -oauth2TokenUrl for")
+	hmacKey := flag.String("hmacKey", "", "key to sign requests with an HMAC of -hmacParts, or @file to read it from")
+	hmacAlgorithm := flag.String("hmacAlgorithm", "sha256", "hash of the HMAC of -hmacKey [sha1 | sha256 | sha512]")
+	hmacParts := flag.String("hmacParts", signing.DefaultParts, "comma separated parts of the request signed by -hmacKey [method | path | query | host | timestamp | body | header:NAME]")
+	hmacHeader := flag.String("hmacHeader", "X-Signature", "header holding the signature of -hmacKey")
+	hmacTimestampHeader := flag.String("hmacTimestampHeader", "X-Timestamp", "header holding the Unix time signed by -hmacKey")
+	hmacEncoding := flag.String("hmacEncoding", "hex", "encoding of the signature of -hmacKey [hex | base64]")
+	awsSigV4 := flag.String("awsSigV4", "", "sign requests with AWS Signature Version 4 for SERVICE:REGION, with the credentials of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables")
 	metricAddr := flag.String("metric-addr", "", "address to serve metrics on")
 	hashValue := flag.Uint64("hashValue", 0, "fnv-1a hash value to check the request body against")
 	hashSampleRate := flag.Float64("hashSampleRate", 0.0, "Sampe Rate for checking request body's hash. Interval in the range of [0.0, 1.0]")
+	rateProfile := flag.String("rateProfile", "", "vary the total rate over time: ramp:FROM:TO:DURATION, step:FROM:STEP:N (every N intervals) or sine:MEAN:AMPLITUDE:PERIOD")
+	arrival := flag.String("arrival", "uniform", "inter-arrival process [uniform | poisson | jitter[:FRACTION] | pareto[:SHAPE]]")
+	seed := flag.Int64("seed", 0, "seed for the random inter-arrival process (0 picks one at random)")
+	searchStrategy := flag.String("search", "", "search for the highest rate meeting the SLO, starting at -rate [bisect | aimd]")
+	sloP99 := flag.Int64("sloP99", 0, "p99 latency SLO for -search, in -latencyUnit units")
+	sloErrorRate := flag.Float64("sloErrorRate", 0.01, "maximum fraction of bad and failed requests for -search")
+	planFile := flag.String("plan", "", "YAML or JSON file describing sequential test stages")
+	scenariosFile := flag.String("scenarios", "", "YAML or JSON file describing named scenarios to run at the same time")
+	templates := flag.Bool("templates", false, "render the URLs, header values and body as Go templates for every request, e.g. {{.RequestID}} or {{uuid}}")
+	urlOrder := flag.String("urlOrder", "sequential", "order in which urls or requests are sent [sequential | random | shuffle | weighted]")
+	feederFile := flag.String("feeder", "", "CSV file with a header row whose columns templates can refer to, e.g. {{.Row.user_id}} (implies -templates)")
+	feederMode := flag.String("feederMode", "sequential", "how rows of -feeder are picked for requests [sequential | random | unique]")
+	feederStop := flag.Bool("feederStop", false, "end the run after the last row of a sequential -feeder instead of starting over")
+	requestsFile := flag.String("requests", "", "JSON lines file describing the requests to send, in place of the target url")
+	harFile := flag.String("har", "", "HAR file whose requests to send, in place of the target url")
+	accessLogFile := flag.String("accessLog", "", "nginx or Apache access log, in the common, combined or a JSON format, whose requests to send to the target url")
+	replayTiming := flag.Bool("replayTiming", false, "send the requests of -requests, -har or -accessLog at their recorded times relative to the first one, instead of at -rate")
+	replaySpeed := flag.Float64("replaySpeed", 1, "factor by which -replayTiming speeds up the replay, e.g. 2 for twice as fast")
+	flowFile := flag.String("flow", "", "YAML or JSON file describing the steps of a flow, sent in order and able to use values extracted from previous responses, in place of the target url")
+	cookies := flag.Bool("cookies", false, "give every request thread its own cookie jar, as a virtual user")
+	userSetupFile := flag.String("userSetup", "", "YAML or JSON file describing the steps every virtual user sends before its first request, e.g. to log in (implies -cookies)")
+	userTeardownFile := flag.String("userTeardown", "", "YAML or JSON file describing the steps every virtual user sends once it stops, e.g. to log out (implies -cookies)")
+	openLoop := flag.Bool("openLoop", false, "dispatch requests on schedule regardless of outstanding responses and measure latency from the intended send time")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s <url> [flags]\n", path.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s -plan <file> [<url>] [flags]\n", path.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s -scenarios <file> [<url>] [flags]\n", path.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s -requests <file> [flags]\n", path.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s -har <file> [flags]\n", path.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s -accessLog <file> <base url> [flags]\n", path.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s -flow <file> [flags]\n", path.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "       %s record [flags] <upstream url>\n", path.Base(os.Args[0]))
 		flag.PrintDefaults()
 	}
 
@@ -66,7 +259,41 @@ func GetArgs() Args {
 		os.Exit(64)
 	}
 
-	if flag.NArg() != 1 {
+	if *planFile != "" && *scenariosFile != "" {
+		exUsage("plan and scenarios cannot be used together")
+	}
+
+	sources := 0
+	for _, file := range []string{*requestsFile, *harFile, *accessLogFile} {
+		if file != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		exUsage("requests, har and accessLog cannot be used together")
+	}
+
+	if *flowFile != "" && (sources > 0 || *planFile != "" || *scenariosFile != "") {
+		exUsage("flow cannot be used with requests, har, accessLog, plan or scenarios")
+	}
+
+	if *accessLogFile != "" {
+		if flag.NArg() != 1 {
+			exUsage("Expecting one argument with -accessLog: the base url to send its requests to, e.g. http://localhost:4140/")
+		}
+	} else if *requestsFile != "" || *harFile != "" {
+		if flag.NArg() > 0 {
+			exUsage("requests, har and a target url cannot be used together")
+		}
+	} else if *flowFile != "" {
+		if flag.NArg() > 0 {
+			exUsage("flow and a target url cannot be used together")
+		}
+	} else if *planFile != "" || *scenariosFile != "" {
+		if flag.NArg() > 1 {
+			exUsage("Expecting at most one argument with -plan or -scenarios: the default target url to test, e.g. http://localhost:4140/")
+		}
+	} else if flag.NArg() != 1 {
 		exUsage("Expecting one argument: the target url to test, e.g. http://localhost:4140/")
 	}
 
@@ -78,6 +305,58 @@ func GetArgs() Args {
 		exUsage("concurrency must be at least 1")
 	}
 
+	if *warmup < 0 {
+		exUsage("warmup cannot be negative")
+	}
+
+	hosts, hostWeights, err := weighted.ParseList(*host)
+	if err != nil {
+		exUsage("host: %s", err)
+	}
+
+	switch *urlOrder {
+	case "sequential", "random", "shuffle", "weighted":
+	default:
+		exUsage("urlOrder should be [sequential | random | shuffle | weighted].")
+	}
+
+	if *drainTimeout < 0 {
+		exUsage("drainTimeout cannot be negative")
+	}
+
+	if *rate < 0 {
+		exUsage("rate cannot be negative")
+	}
+
+	if *rate > 0 && *rateProfile != "" {
+		exUsage("rate and rateProfile cannot be used together")
+	}
+
+	if *replaySpeed <= 0 {
+		exUsage("replaySpeed must be positive")
+	}
+
+	if *replayTiming {
+		if *requestsFile == "" && *harFile == "" && *accessLogFile == "" {
+			exUsage("replayTiming requires -requests, -har or -accessLog")
+		}
+		if *rate > 0 || *rateProfile != "" || *searchStrategy != "" || *planFile != "" || *scenariosFile != "" {
+			exUsage("replayTiming cannot be used with rate, rateProfile, search, plan or scenarios")
+		}
+		if *urlOrder != "sequential" {
+			exUsage("replayTiming sends the requests in their recorded order and cannot be used with urlOrder")
+		}
+	}
+
+	if *flowFile != "" {
+		if *urlOrder != "sequential" {
+			exUsage("flow sends its steps in order and cannot be used with urlOrder")
+		}
+		if *hashSampleRate > 0 {
+			exUsage("flow cannot be used with hashSampleRate")
+		}
+	}
+
 	latencyDur := time.Millisecond
 	if *latencyUnit == "ms" {
 		latencyDur = time.Millisecond
@@ -89,27 +368,255 @@ func GetArgs() Args {
 		exUsage("latency unit should be [ms | us | ns].")
 	}
 
+	var profile pacer.Profile = pacer.Constant(*qps * *concurrency)
+	if *rate > 0 {
+		profile = pacer.Constant(*rate)
+	} else if *rateProfile != "" {
+		var err error
+		profile, err = pacer.ParseProfile(*rateProfile, *interval)
+		if err != nil {
+			exUsage(err.Error())
+		}
+	}
+
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	arrivalProcess, err := pacer.ParseArrival(*arrival, *seed)
+	if err != nil {
+		exUsage(err.Error())
+	}
+
+	var strategy search.Strategy
+	if *searchStrategy != "" {
+		if *rateProfile != "" {
+			exUsage("search and rateProfile cannot be used together")
+		}
+		if *sloP99 < 1 {
+			exUsage("sloP99 must be set to search")
+		}
+		if *sloErrorRate < 0.0 || *sloErrorRate > 1.0 {
+			exUsage("sloErrorRate must be in the range [0.0, 1.0]")
+		}
+		strategy, err = search.New(*searchStrategy, profile.Rate(0))
+		if err != nil {
+			exUsage(err.Error())
+		}
+	}
+
+	var stages []plan.Stage
+	if *planFile != "" {
+		if *searchStrategy != "" || *iterationCount > 0 || *totalRequests > 0 {
+			exUsage("search, iterations and totalRequests cannot be used with plan")
+		}
+		stages, err = plan.Load(*planFile, *interval)
+		if err != nil {
+			exUsage(err.Error())
+		}
+		for _, stage := range stages {
+			if len(stage.Urls) == 0 && flag.NArg() == 0 && *requestsFile == "" && *harFile == "" {
+				exUsage("%s: %s has no urls and no target url was given", *planFile, stage.Name)
+			}
+		}
+	}
+
+	var scenarios []plan.Stage
+	if *scenariosFile != "" {
+		if *searchStrategy != "" {
+			exUsage("search cannot be used with scenarios")
+		}
+		scenarios, err = plan.LoadScenarios(*scenariosFile, *interval)
+		if err != nil {
+			exUsage(err.Error())
+		}
+		for _, scenario := range scenarios {
+			if len(scenario.Urls) == 0 && flag.NArg() == 0 && *requestsFile == "" && *harFile == "" {
+				exUsage("%s: %s has no urls and no target url was given", *scenariosFile, scenario.Name)
+			}
+		}
+	}
+
+	var dstUrls []string
+	var requests []reqspec.Request
+	var timeline []time.Duration
+	var skippedLines int
+	if *requestsFile != "" {
+		requests, err = reqspec.Load(*requestsFile)
+		if err != nil {
+			exUsage(err.Error())
+		}
+		if *replayTiming {
+			var offsets []time.Duration
+			requests, offsets, err = reqspec.Offsets(requests)
+			if err != nil {
+				exUsage("%s: %s", *requestsFile, err)
+			}
+			timeline = scaleTimeline(offsets, *replaySpeed)
+		}
+		dstUrls = requestURLs(requests)
+	} else if *harFile != "" || *accessLogFile != "" {
+		var offsets []time.Duration
+		if *harFile != "" {
+			requests, offsets, err = har.Load(*harFile)
+		} else {
+			base := flag.Arg(0)
+			parseBaseURL(base)
+			requests, offsets, skippedLines, err = accesslog.Load(*accessLogFile, base)
+		}
+		if err != nil {
+			exUsage(err.Error())
+		}
+		dstUrls = requestURLs(requests)
+		if *replayTiming {
+			timeline = scaleTimeline(offsets, *replaySpeed)
+		}
+	} else if flag.NArg() == 1 {
+		dstUrls = loadURLs(flag.Arg(0))
+	}
+
+	var steps []flow.Step
+	if *flowFile != "" {
+		steps, err = flow.Load(*flowFile)
+		if err != nil {
+			exUsage(err.Error())
+		}
+		// Steps refer to extracted values through templates.
+		*templates = true
+	}
+
+	var userSetup, userTeardown []flow.Step
+	if *userSetupFile != "" {
+		userSetup, err = flow.Load(*userSetupFile)
+		if err != nil {
+			exUsage(err.Error())
+		}
+	}
+	if *userTeardownFile != "" {
+		userTeardown, err = flow.Load(*userTeardownFile)
+		if err != nil {
+			exUsage(err.Error())
+		}
+	}
+	if userSetup != nil || userTeardown != nil {
+		*cookies = true
+		*templates = true
+	}
+
+	var rows *feeder.Feeder
+	if *feederFile != "" {
+		rows, err = feeder.Load(*feederFile, *feederMode, *feederStop)
+		if err != nil {
+			exUsage("feeder: %s", err)
+		}
+		*templates = true
+	} else if *feederStop {
+		exUsage("feederStop requires -feeder")
+	}
+
+	provider := getAuth(*basicAuth, *bearerTokenFile, *oauth2TokenUrl, *oauth2ClientId, *oauth2ClientSecret, *oauth2Scope, *clientTimeout)
+	signer := getSigner(*hmacKey, *hmacAlgorithm, *hmacParts, *hmacHeader, *hmacTimestampHeader, *hmacEncoding, *awsSigV4)
+	if _, ok := signer.(*signing.SigV4); ok && provider != nil {
+		exUsage("awsSigV4 sets the Authorization header and cannot be used with basicAuth, bearerTokenFile or oauth2TokenUrl")
+	}
+	headers, err := loadHeaders(*headerString, *headerFile)
+	if err != nil {
+		exUsage("headerFile: %s", err)
+	}
+	body := loadBodyPayload(*data)
+	if len(formFields) > 0 && *data != "" {
+		exUsage("form and data cannot be used together")
+	}
+	requestForm := getForm(formFields, *formEncoding)
+	if *templates {
+		columns := rows.Columns()
+		values := flow.Values(userSetup, len(userSetup))
+		if err := checkTemplates(dstUrls, headers, body, columns, values); err != nil {
+			exUsage(err.Error())
+		}
+		if err := checkFormTemplates(requestForm, columns, values); err != nil {
+			exUsage("form: %s", err)
+		}
+		if err := checkRequestTemplates(requests, columns, values); err != nil {
+			exUsage("%s: %s", *requestsFile, err)
+		}
+		if err := checkFlowTemplates(steps, columns, values); err != nil {
+			exUsage("%s: %s", *flowFile, err)
+		}
+		if err := checkFlowTemplates(userSetup, columns, nil); err != nil {
+			exUsage("%s: %s", *userSetupFile, err)
+		}
+		if err := checkFlowTemplates(userTeardown, columns, values); err != nil {
+			exUsage("%s: %s", *userTeardownFile, err)
+		}
+		for _, stages := range [][]plan.Stage{stages, scenarios} {
+			for _, stage := range stages {
+				if err := checkTemplates(stage.Urls, stage.Headers, stage.Body, columns, values); err != nil {
+					exUsage("%s: %s", stage.Name, err)
+				}
+			}
+		}
+	}
+
+	for _, step := range steps {
+		dstUrls = append(dstUrls, step.URL)
+	}
+
 	return Args{
 		Qps:              *qps,
 		Concurrency:      *concurrency,
 		IterationCount:   *iterationCount,
-		Host:             strings.Split(*host, ","),
+		Warmup:           *warmup,
+		WarmupIterations: *warmupIterations,
+		Host:             hosts,
+		HostWeights:      hostWeights,
 		Method:           *method,
 		Interval:         *interval,
 		NoReuse:          *noreuse,
 		Compress:         *compress,
 		ClientTimeout:    *clientTimeout,
+		DrainTimeout:     *drainTimeout,
 		NoLatencySummary: *noLatencySummary,
 		ReportLatencyCsv: *reportLatenciesCSV,
 		LatencyUnit:      *latencyUnit,
 		LatencyDuration:  latencyDur,
 		Help:             *help,
 		TotalRequests:    *totalRequests,
-		Headers:          getHeaders(*headerString),
-		Data:             loadBodyPayload(*data),
+		Headers:          headers,
+		Auth:             provider,
+		Signer:           signer,
+		Data:             body,
+		Form:             requestForm,
 		MetricAddr:       *metricAddr,
 		HashValue:        *hashValue,
 		HashSampleRate:   *hashSampleRate,
-		DstUrls:          loadURLs(flag.Arg(0)),
+		OpenLoop:         *openLoop,
+		Templates:        *templates,
+		Feeder:           rows,
+		RateProfile:      profile,
+		Arrival:          arrivalProcess,
+		Seed:             *seed,
+		Search:           strategy,
+		SloP99:           *sloP99,
+		SloErrorRate:     *sloErrorRate,
+		Plan:             stages,
+		Scenarios:        scenarios,
+		Flow:             steps,
+		Cookies:          *cookies,
+		UserSetup:        userSetup,
+		UserTeardown:     userTeardown,
+		DstUrls:          dstUrls,
+		UrlOrder:         *urlOrder,
+		Requests:         requests,
+		Timeline:         timeline,
+		ReplaySpeed:      *replaySpeed,
+		UrlSource:        flag.Arg(0),
+		DataSource:       *data,
+		HeaderSource:     *headerString,
+		HeaderFile:       *headerFile,
+		RequestsFile:     *requestsFile,
+		HarFile:          *harFile,
+		AccessLogFile:    *accessLogFile,
+		FlowFile:         *flowFile,
+		SkippedLines:     skippedLines,
 	}
 }
@@ -2,28 +2,64 @@ package cli
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vspaz/slow_cooker/internal/flow"
+	"github.com/vspaz/slow_cooker/internal/form"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
 func TestOneHeaderPairOk(t *testing.T) {
 	headerToValue := getHeaders("key1: value1")
-	assert.Equal(t, "value1", headerToValue["key1"])
+	assert.Equal(t, "value1", headerToValue.Get("key1"))
 }
 
 func TestMultipleHeaderPairOk(t *testing.T) {
 	headerToValue := getHeaders("key1: value1, key2: value2, key3: value3")
-	assert.Equal(t, "value1", headerToValue["key1"])
-	assert.Equal(t, "value2", headerToValue["key2"])
-	assert.Equal(t, "value3", headerToValue["key3"])
+	assert.Equal(t, "value1", headerToValue.Get("key1"))
+	assert.Equal(t, "value2", headerToValue.Get("key2"))
+	assert.Equal(t, "value3", headerToValue.Get("key3"))
 }
 
 func TestBadlyFormattedHeaderStringOk(t *testing.T) {
 	badlyFormattedHeaderString := " key1:value1,    key2: value2,key3:  value3 , "
 	headerToValue := getHeaders(badlyFormattedHeaderString)
 	assert.Equal(t, 3, len(headerToValue))
-	assert.Equal(t, "value1", headerToValue["key1"])
-	assert.Equal(t, "value2", headerToValue["key2"])
-	assert.Equal(t, "value3", headerToValue["key3"])
+	assert.Equal(t, "value1", headerToValue.Get("key1"))
+	assert.Equal(t, "value2", headerToValue.Get("key2"))
+	assert.Equal(t, "value3", headerToValue.Get("key3"))
+}
+
+func TestHeaderValuesWithColonsAndRepeatedNamesOk(t *testing.T) {
+	header := getHeaders("Referer: http://a.test:8080/, X-Tag: a, X-Tag: b")
+	assert.Equal(t, http.Header{"Referer": {"http://a.test:8080/"}, "X-Tag": {"a", "b"}}, header)
+}
+
+func TestParseHeaderFileOk(t *testing.T) {
+	header, err := parseHeaderFile("headers.txt", strings.NewReader("# sent with every request\r\n"+
+		"Accept: text/html, application/json;q=0.9\r\n"+
+		"\r\n"+
+		"If-Modified-Since: Wed, 21 Oct 2015 07:28:00 GMT\n"+
+		"x-tag: a\n"+
+		"X-Tag: b\n"+
+		"X-Empty:\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.Header{
+		"Accept":            {"text/html, application/json;q=0.9"},
+		"If-Modified-Since": {"Wed, 21 Oct 2015 07:28:00 GMT"},
+		"X-Tag":             {"a", "b"},
+		"X-Empty":           {""},
+	}, header)
+}
+
+func TestParseHeaderFileErrors(t *testing.T) {
+	for _, text := range []string{"Accept text/html\n", "X-Tag: a\n: b\n", "Bad Name: c\n"} {
+		_, err := parseHeaderFile("headers.txt", strings.NewReader(text))
+		assert.Regexp(t, `^headers.txt:\d: expected 'Name: value'$`, err, text)
+	}
 }
 
 func TestMissingHeaderNameOk(t *testing.T) {
@@ -34,3 +70,112 @@ func TestMissingHeaderNameOk(t *testing.T) {
 func TestNoHeadersOk(t *testing.T) {
 	assert.Empty(t, getHeaders(" "))
 }
+
+func TestReloadReadsFilesAgain(t *testing.T) {
+	dir := t.TempDir()
+	urlFile := filepath.Join(dir, "urls.txt")
+	bodyFile := filepath.Join(dir, "body.txt")
+	require.NoError(t, os.WriteFile(urlFile, []byte("http://a.test/\n"), 0o644))
+	require.NoError(t, os.WriteFile(bodyFile, []byte("one"), 0o644))
+	args := Args{
+		DstUrls:    loadURLs("@" + urlFile),
+		Data:       loadBodyPayload("@" + bodyFile),
+		UrlSource:  "@" + urlFile,
+		DataSource: "@" + bodyFile,
+	}
+
+	require.NoError(t, os.WriteFile(urlFile, []byte("http://b.test/\nhttp://c.test/\n"), 0o644))
+	require.NoError(t, os.WriteFile(bodyFile, []byte("two"), 0o644))
+	files, err := args.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{urlFile, bodyFile}, files)
+	assert.Equal(t, []string{"http://b.test/", "http://c.test/"}, args.DstUrls)
+	assert.Equal(t, []byte("two"), args.Data)
+}
+
+func TestReloadReadsHeaderFileAgain(t *testing.T) {
+	headerFile := filepath.Join(t.TempDir(), "headers.txt")
+	require.NoError(t, os.WriteFile(headerFile, []byte("X-Tag: a\n"), 0o644))
+	headers, err := loadHeaders("X-Tag: flag, X-Stage: flag", headerFile)
+	require.NoError(t, err)
+	args := Args{
+		DstUrls:      []string{"http://a.test/"},
+		Headers:      headers,
+		HeaderSource: "X-Tag: flag, X-Stage: flag",
+		HeaderFile:   headerFile,
+		StageHeaders: http.Header{"X-Stage": {"stage"}},
+	}
+
+	require.NoError(t, os.WriteFile(headerFile, []byte("X-Tag: b\nX-Tag: c\n"), 0o644))
+	files, err := args.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{headerFile}, files)
+	assert.Equal(t, http.Header{"X-Tag": {"flag", "b", "c"}, "X-Stage": {"stage"}}, args.Headers)
+
+	require.NoError(t, os.WriteFile(headerFile, []byte("X-Tag b\n"), 0o644))
+	_, err = args.Reload()
+	assert.EqualError(t, err, headerFile+":1: expected 'Name: value'")
+	assert.Equal(t, []string{"flag", "b", "c"}, args.Headers["X-Tag"])
+}
+
+func TestReloadSkipsInlineValues(t *testing.T) {
+	args := Args{
+		DstUrls:    []string{"http://a.test/"},
+		Data:       []byte("inline"),
+		UrlSource:  "http://a.test/",
+		DataSource: "inline",
+	}
+	files, err := args.Reload()
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	assert.Equal(t, []string{"http://a.test/"}, args.DstUrls)
+}
+
+func TestReloadKeepsTargetsOnError(t *testing.T) {
+	urlFile := filepath.Join(t.TempDir(), "urls.txt")
+	require.NoError(t, os.WriteFile(urlFile, []byte("not a url\n"), 0o644))
+	args := Args{DstUrls: []string{"http://a.test/"}, UrlSource: "@" + urlFile}
+	_, err := args.Reload()
+	assert.EqualError(t, err, "invalid URL on line 1: 'not a url': Missing scheme")
+	assert.Equal(t, []string{"http://a.test/"}, args.DstUrls)
+
+	require.NoError(t, os.WriteFile(urlFile, nil, 0o644))
+	_, err = args.Reload()
+	assert.EqualError(t, err, urlFile+": no urls")
+}
+
+func TestLoadURLsKeepsTemplates(t *testing.T) {
+	urls := loadURLs("http://a.test/{{.RequestID}}?q={{randString 4}}")
+	assert.Equal(t, []string{"http://a.test/{{.RequestID}}?q={{randString 4}}"}, urls)
+}
+
+func TestCheckTemplates(t *testing.T) {
+	assert.NoError(t, checkTemplates([]string{"http://a.test/{{.WorkerID}}"}, http.Header{"X-Id": {"{{uuid}}"}}, []byte("{{counter \"n\"}}"), nil, nil))
+	assert.EqualError(t, checkTemplates(nil, http.Header{"X-Id": {"{{uid}}"}}, nil, nil, nil), `template: X-Id:1: function "uid" not defined`)
+	assert.NoError(t, checkTemplates([]string{"http://a.test/{{.Row.user_id}}"}, nil, nil, []string{"user_id"}, nil))
+	assert.NoError(t, checkTemplates([]string{"http://a.test/{{.Values.session}}"}, nil, nil, nil, []string{"session"}))
+	assert.EqualError(t, checkTemplates([]string{"http://a.test/{{.Row.sku}}"}, nil, nil, []string{"user_id"}, nil), `template: url:1:20: executing "url" at <.Row.sku>: map has no entry for key "sku"`)
+}
+
+func TestCheckFlowTemplates(t *testing.T) {
+	steps := []flow.Step{
+		{Name: "login", URL: "http://a.test/login", Body: []byte(`{"user": "{{.Row.user}}"}`), Extract: []flow.Extraction{{Name: "token"}}},
+		{Name: "fetch", URL: "http://a.test/items", Headers: map[string]string{"Authorization": "Bearer {{.Values.token}}"}},
+	}
+	assert.NoError(t, checkFlowTemplates(steps, []string{"user"}, nil))
+	steps[0].Headers = map[string]string{"X-Csrf": "{{.Values.csrf}}"}
+	assert.NoError(t, checkFlowTemplates(steps, []string{"user"}, []string{"csrf"}))
+	steps[0].URL = "http://a.test/login/{{.Values.token}}"
+	assert.EqualError(t, checkFlowTemplates(steps, []string{"user"}, []string{"csrf"}), `template: login:1:29: executing "login" at <.Values.token>: map has no entry for key "token"`)
+}
+
+func TestCheckFormTemplates(t *testing.T) {
+	f, err := form.New([]form.Field{
+		{Name: "user", Value: "{{.Row.user}}"},
+		{Name: "avatar", Path: "avatar.png", Content: []byte("{{")},
+	}, "")
+	require.NoError(t, err)
+	assert.NoError(t, checkFormTemplates(f, []string{"user"}, nil))
+	assert.EqualError(t, checkFormTemplates(f, nil, nil), `template: user:1:6: executing "user" at <.Row.user>: map has no entry for key "user"`)
+	assert.NoError(t, checkFormTemplates(nil, nil, nil))
+}
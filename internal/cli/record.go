@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+)
+
+// RecordArgs are the arguments of the record command.
+type RecordArgs struct {
+	Listen   string
+	Upstream *url.URL
+	// Base replaces the scheme, host and base path of Upstream in the
+	// recorded URLs, to replay them elsewhere.
+	Base *url.URL
+	Out  string
+}
+
+// GetRecordArgs parses the arguments of the record command, which follow the
+// command name.
+func GetRecordArgs(arguments []string) RecordArgs {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	listen := flags.String("listen", ":8080", "address to listen on for the requests to record")
+	out := flags.String("out", "requests.jsonl", "JSON lines file to write the recorded requests to, see -requests. It must not exist yet")
+	base := flags.String("base", "", "url to write in the recorded urls in place of the upstream url, e.g. the one of a staging service")
+	help := flags.Bool("help", false, "show help message")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s record [flags] <upstream url>\n", path.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	flags.Parse(arguments)
+
+	if *help {
+		flags.Usage()
+		os.Exit(64)
+	}
+	if flags.NArg() != 1 {
+		exUsage("Expecting one argument: the upstream url to forward requests to, e.g. http://localhost:4140/")
+	}
+	upstream := parseBaseURL(flags.Arg(0))
+	recorded := upstream
+	if *base != "" {
+		recorded = parseBaseURL(*base)
+	}
+	if *out == "" {
+		exUsage("out cannot be empty")
+	}
+
+	return RecordArgs{
+		Listen:   *listen,
+		Upstream: upstream,
+		Base:     recorded,
+		Out:      *out,
+	}
+}
+
+// parseBaseURL parses a url that paths are appended to, or exits.
+func parseBaseURL(text string) *url.URL {
+	URL, err := url.Parse(text)
+	if err != nil || URL.Scheme == "" || URL.Host == "" {
+		exUsage("invalid base url '%s'", text)
+	}
+	return URL
+}
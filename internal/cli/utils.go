@@ -2,11 +2,20 @@ package cli
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"github.com/vspaz/slow_cooker/internal/auth"
+	"github.com/vspaz/slow_cooker/internal/flow"
+	"github.com/vspaz/slow_cooker/internal/form"
+	"github.com/vspaz/slow_cooker/internal/reqspec"
+	"github.com/vspaz/slow_cooker/internal/signing"
+	"github.com/vspaz/slow_cooker/internal/templating"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 func exUsage(msg string, args ...interface{}) {
@@ -15,54 +24,223 @@ func exUsage(msg string, args ...interface{}) {
 	os.Exit(64)
 }
 
-func getHeaders(text string) map[string]string {
-	headerNameToValue := make(map[string]string)
-	headers := strings.Split(text, ",")
-	for _, header := range headers {
-		headerNameAndValue := strings.Split(header, ":")
-		if len(headerNameAndValue) == 2 {
-			headerName := strings.TrimSpace(headerNameAndValue[0])
-			headerValue := strings.TrimSpace(headerNameAndValue[1])
-			if len(headerName) > 0 {
-				headerNameToValue[headerName] = headerValue
-			}
+// getHeaders parses headers written as "key1: value1, key2: value2". Values
+// can't hold commas, see readHeaderFile.
+func getHeaders(text string) http.Header {
+	header := make(http.Header)
+	for _, field := range strings.Split(text, ",") {
+		name, value, ok := strings.Cut(field, ":")
+		name = strings.TrimSpace(name)
+		if ok && len(name) > 0 {
+			header.Add(name, strings.TrimSpace(value))
 		}
 	}
-	return headerNameToValue
+	return header
 }
 
-func loadBodyPayload(data string) []byte {
-	var file *os.File
-	var body []byte
-	var err error
-	if strings.HasPrefix(data, "@") {
-		filePath := data[1:]
-		if filePath == "-" {
-			file = os.Stdin
-		} else {
-			file, err = os.Open(filePath)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, err.Error())
-				os.Exit(1)
-			}
-			defer file.Close()
+// loadHeaders returns the headers of -headers, followed by those of the
+// -headerFile at path if set.
+func loadHeaders(text, path string) (http.Header, error) {
+	headers := getHeaders(text)
+	if path == "" {
+		return headers, nil
+	}
+	fileHeaders, err := readHeaderFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range fileHeaders {
+		headers[name] = append(headers[name], values...)
+	}
+	return headers, nil
+}
+
+// readHeaderFile reads the headers of the file at path, see parseHeaderFile.
+func readHeaderFile(path string) (http.Header, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseHeaderFile(path, file)
+}
+
+// parseHeaderFile parses the file of the given name, which holds a raw
+// "Name: value" header per line. Names can be repeated, and values hold
+// anything up to the end of the line. Empty lines and lines starting with #
+// are ignored.
+func parseHeaderFile(name string, r io.Reader) (http.Header, error) {
+	header := make(http.Header)
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
+		headerName, value, ok := strings.Cut(line, ":")
+		if !ok || headerName == "" || strings.ContainsAny(headerName, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected 'Name: value'", name, lineNumber)
+		}
+		header.Add(headerName, strings.TrimSpace(value))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return header, nil
+}
 
-		body, err = io.ReadAll(file)
+// getAuth returns the auth provider of the flags, nil if none is set.
+func getAuth(basicAuth, bearerTokenFile, tokenURL, clientID, clientSecret, scope string, timeout time.Duration) auth.Provider {
+	set := 0
+	for _, flag := range []string{basicAuth, bearerTokenFile, tokenURL} {
+		if flag != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		exUsage("basicAuth, bearerTokenFile and oauth2TokenUrl cannot be used together")
+	}
+	if tokenURL == "" && (clientID != "" || clientSecret != "" || scope != "") {
+		exUsage("oauth2ClientId, oauth2ClientSecret and oauth2Scope require -oauth2TokenUrl")
+	}
+	switch {
+	case basicAuth != "":
+		provider, err := auth.NewBasic(basicAuth)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, err.Error())
-			os.Exit(1)
+			exUsage("basicAuth: %s", err)
 		}
-	} else {
-		body = []byte(data)
+		return provider
+	case bearerTokenFile != "":
+		provider, err := auth.LoadBearer(bearerTokenFile)
+		if err != nil {
+			exUsage("bearerTokenFile: %s", err)
+		}
+		return provider
+	case tokenURL != "":
+		secret, err := readBody(clientSecret)
+		if err != nil {
+			exUsage("oauth2ClientSecret: %s", err)
+		}
+		provider, err := auth.NewOAuth2(tokenURL, clientID, strings.TrimSpace(string(secret)), scope, timeout)
+		if err != nil {
+			exUsage("oauth2TokenUrl: %s", err)
+		}
+		return provider
+	}
+	return nil
+}
+
+// getSigner returns the request signer of the flags, nil if none is set.
+func getSigner(hmacKey, algorithm, parts, header, timestampHeader, encoding, awsSigV4 string) signing.Signer {
+	if hmacKey != "" && awsSigV4 != "" {
+		exUsage("hmacKey and awsSigV4 cannot be used together")
+	}
+	if hmacKey != "" {
+		key, err := readBody(hmacKey)
+		if err != nil {
+			exUsage("hmacKey: %s", err)
+		}
+		signer, err := signing.NewHMAC([]byte(strings.TrimSpace(string(key))), algorithm, parts, header, timestampHeader, encoding)
+		if err != nil {
+			exUsage("hmacKey: %s", err)
+		}
+		return signer
+	}
+	if awsSigV4 != "" {
+		service, region, _ := strings.Cut(awsSigV4, ":")
+		signer, err := signing.NewSigV4(service, region, os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN"))
+		if err != nil {
+			exUsage("awsSigV4: %s", err)
+		}
+		return signer
+	}
+	return nil
+}
+
+// repeatedFlag holds the values of a flag that can be repeated.
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// getForm returns the form of the -form fields, nil if there are none.
+func getForm(fields []string, encoding string) *form.Form {
+	if len(fields) == 0 {
+		if encoding != "" {
+			exUsage("formEncoding requires -form")
+		}
+		return nil
 	}
+	parsed := make([]form.Field, len(fields))
+	for i, text := range fields {
+		field, err := form.ParseField(text)
+		if err != nil {
+			exUsage("form: %s", err)
+		}
+		parsed[i] = field
+	}
+	f, err := form.New(parsed, encoding)
+	if err != nil {
+		exUsage("form: %s", err)
+	}
+	return f
+}
 
+func loadBodyPayload(data string) []byte {
+	body, err := readBody(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, err.Error())
+		os.Exit(1)
+	}
 	return body
 }
 
+// readBody returns data, or the contents of the file it names if it starts
+// with '@'. "@-" reads the standard input.
+func readBody(data string) ([]byte, error) {
+	if !strings.HasPrefix(data, "@") {
+		return []byte(data), nil
+	}
+	filePath := data[1:]
+	if filePath == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(filePath)
+}
+
 func loadURLs(urldest string) []string {
+	urls, err := readURLs(urldest)
+	if err != nil {
+		var invalid *invalidURLError
+		if errors.As(err, &invalid) {
+			exUsage(err.Error())
+		}
+		fmt.Fprintf(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	return urls
+}
+
+type invalidURLError struct {
+	line int
+	url  string
+	msg  string
+}
+
+func (e *invalidURLError) Error() string {
+	return fmt.Sprintf("invalid URL on line %d: '%s': %s", e.line, e.url, e.msg)
+}
+
+// readURLs returns the URL urldest, or the URLs listed one per line in the
+// file it names if it starts with '@'. "@-" reads the standard input.
+func readURLs(urldest string) ([]string, error) {
 	var urls []string
-	var err error
 	var scanner *bufio.Scanner
 
 	if strings.HasPrefix(urldest, "@") {
@@ -71,10 +249,10 @@ func loadURLs(urldest string) []string {
 		if filePath == "-" {
 			file = os.Stdin
 		} else {
+			var err error
 			file, err = os.Open(filePath)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, err.Error())
-				os.Exit(1)
+				return nil, err
 			}
 			defer file.Close()
 		}
@@ -85,16 +263,113 @@ func loadURLs(urldest string) []string {
 
 	for i := 1; scanner.Scan(); i++ {
 		line := scanner.Text()
+		if strings.Contains(line, "{{") {
+			// Templates are checked with -templates, and the URLs they
+			// render to when requests are sent.
+			urls = append(urls, line)
+			continue
+		}
 		URL, err := url.Parse(line)
 		if err != nil {
-			exUsage("invalid URL on line %d: '%s': %s\n", i, line, err.Error())
+			return nil, &invalidURLError{i, line, err.Error()}
 		} else if URL.Scheme == "" {
-			exUsage("invalid URL on line %d: '%s': Missing scheme\n", i, line)
+			return nil, &invalidURLError{i, line, "Missing scheme"}
 		} else if URL.Host == "" {
-			exUsage("invalid URL on line %d: '%s': Missing host\n", i, line)
+			return nil, &invalidURLError{i, line, "Missing host"}
 		}
 		urls = append(urls, URL.String())
 	}
 
+	return urls, scanner.Err()
+}
+
+// checkTemplates returns an error if a URL, header value or body isn't a
+// valid template referring to the given feeder columns and extracted values.
+func checkTemplates(urls []string, headers http.Header, body []byte, columns []string, values []string) error {
+	for _, rawURL := range urls {
+		if _, err := templating.Parse("url", rawURL, columns, values); err != nil {
+			return err
+		}
+	}
+	for name, headerValues := range headers {
+		for _, value := range headerValues {
+			if _, err := templating.Parse(name, value, columns, values); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := templating.Parse("body", string(body), columns, values)
+	return err
+}
+
+// checkRequestTemplates returns an error if the URL, a header value or the
+// body of a request isn't a valid template referring to the given feeder
+// columns and extracted values.
+func checkRequestTemplates(requests []reqspec.Request, columns []string, values []string) error {
+	for i, request := range requests {
+		texts := []string{request.URL, string(request.Body)}
+		for _, headerValues := range request.Header {
+			texts = append(texts, headerValues...)
+		}
+		for _, text := range texts {
+			if _, err := templating.Parse(fmt.Sprintf("request %d", i+1), text, columns, values); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkFlowTemplates returns an error if the URL, a header value or the body
+// of a step isn't a valid template referring to the given feeder columns,
+// the given extracted values and those extracted by the steps before it.
+func checkFlowTemplates(steps []flow.Step, columns []string, values []string) error {
+	for i, step := range steps {
+		texts := []string{step.URL, string(step.Body)}
+		for _, value := range step.Headers {
+			texts = append(texts, value)
+		}
+		stepValues := append(append([]string(nil), values...), flow.Values(steps, i)...)
+		for _, text := range texts {
+			if _, err := templating.Parse(step.Name, text, columns, stepValues); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkFormTemplates returns an error if the value of a field of f isn't a
+// valid template referring to the given feeder columns and extracted values.
+// The content of files isn't rendered.
+func checkFormTemplates(f *form.Form, columns []string, values []string) error {
+	if f == nil {
+		return nil
+	}
+	for _, field := range f.Fields {
+		if field.IsFile() {
+			continue
+		}
+		if _, err := templating.Parse(field.Name, field.Value, columns, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func requestURLs(requests []reqspec.Request) []string {
+	urls := make([]string, len(requests))
+	for i, request := range requests {
+		urls[i] = request.URL
+	}
 	return urls
 }
+
+// scaleTimeline returns the offsets of a replay sped up by speed.
+func scaleTimeline(offsets []time.Duration, speed float64) []time.Duration {
+	timeline := make([]time.Duration, len(offsets))
+	for i, offset := range offsets {
+		timeline[i] = time.Duration(float64(offset) / speed)
+	}
+	return timeline
+}
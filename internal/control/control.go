@@ -0,0 +1,128 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/vspaz/slow_cooker/internal/hdrreport"
+)
+
+// ErrUnknownScenario is returned by a Target for a scenario it doesn't run.
+var ErrUnknownScenario = errors.New("unknown scenario")
+
+// Status describes a running workload.
+type Status struct {
+	Name        string              `json:"name,omitempty"`
+	State       string              `json:"state"`
+	Rate        float64             `json:"rate"`
+	Concurrency int                 `json:"concurrency"`
+	Iteration   uint64              `json:"iteration"`
+	Requests    uint64              `json:"requests"`
+	Elapsed     float64             `json:"elapsedSeconds"`
+	Latency     hdrreport.Quantiles `json:"latency"`
+}
+
+// Update changes the traffic of a running workload. Fields left out are not
+// changed.
+type Update struct {
+	Rate        *float64 `json:"rate"`
+	Concurrency *int     `json:"concurrency"`
+}
+
+// Target is the load test driven by the control API. scenario is empty
+// unless the caller picked one with the scenario query parameter, in which
+// case only that scenario is affected.
+type Target interface {
+	Status() []Status
+	Update(scenario string, update Update) error
+	Pause(scenario string) error
+	Resume(scenario string) error
+	// Stop gracefully stops the load test, printing its summary.
+	Stop()
+}
+
+// RegisterHandlers adds the control endpoints to the default ServeMux:
+//
+//	GET   /control/status   status of each running workload
+//	PATCH /control/traffic  change the rate and/or concurrency
+//	POST  /control/pause    stop sending traffic until resumed
+//	POST  /control/resume   resume sending traffic
+//	POST  /control/stop     stop the load test and print its summary
+func RegisterHandlers(target Target) {
+	http.HandleFunc("/control/status", handle(http.MethodGet, func(r *http.Request) (any, error) {
+		return target.Status(), nil
+	}))
+	http.HandleFunc("/control/traffic", handle(http.MethodPatch, func(r *http.Request) (any, error) {
+		var update Update
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&update); err != nil {
+			return nil, badRequest{fmt.Errorf("invalid update: %s", err)}
+		}
+		if update.Rate != nil && *update.Rate <= 0 {
+			return nil, badRequest{errors.New("rate must be positive")}
+		}
+		if update.Concurrency != nil && *update.Concurrency < 1 {
+			return nil, badRequest{errors.New("concurrency must be at least 1")}
+		}
+		if err := target.Update(r.URL.Query().Get("scenario"), update); err != nil {
+			return nil, err
+		}
+		return target.Status(), nil
+	}))
+	http.HandleFunc("/control/pause", handle(http.MethodPost, func(r *http.Request) (any, error) {
+		if err := target.Pause(r.URL.Query().Get("scenario")); err != nil {
+			return nil, err
+		}
+		return target.Status(), nil
+	}))
+	http.HandleFunc("/control/resume", handle(http.MethodPost, func(r *http.Request) (any, error) {
+		if err := target.Resume(r.URL.Query().Get("scenario")); err != nil {
+			return nil, err
+		}
+		return target.Status(), nil
+	}))
+	http.HandleFunc("/control/stop", handle(http.MethodPost, func(r *http.Request) (any, error) {
+		target.Stop()
+		return map[string]string{"state": "stopping"}, nil
+	}))
+}
+
+// badRequest marks errors caused by the request rather than the target.
+type badRequest struct {
+	error
+}
+
+// handle returns a handler only accepting method that writes what f returns
+// as JSON.
+func handle(method string, f func(r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+
+		body, err := f(r)
+		var invalid badRequest
+		if errors.As(err, &invalid) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		} else if errors.Is(err, ErrUnknownScenario) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
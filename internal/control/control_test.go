@@ -0,0 +1,98 @@
+package control
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeTarget struct {
+	status  Status
+	stopped bool
+}
+
+func (f *fakeTarget) Status() []Status {
+	return []Status{f.status}
+}
+
+func (f *fakeTarget) Update(scenario string, update Update) error {
+	if scenario != "" {
+		return ErrUnknownScenario
+	}
+	if update.Rate != nil {
+		f.status.Rate = *update.Rate
+	}
+	if update.Concurrency != nil {
+		f.status.Concurrency = *update.Concurrency
+	}
+	return nil
+}
+
+func (f *fakeTarget) Pause(scenario string) error {
+	if f.status.State == "paused" {
+		return errors.New("already paused")
+	}
+	f.status.State = "paused"
+	return nil
+}
+
+func (f *fakeTarget) Resume(scenario string) error {
+	f.status.State = "running"
+	return nil
+}
+
+func (f *fakeTarget) Stop() {
+	f.stopped = true
+}
+
+func request(t *testing.T, server *httptest.Server, method string, path string, body string) (int, string) {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(data))
+}
+
+func TestControlApiOk(t *testing.T) {
+	target := &fakeTarget{status: Status{State: "running", Rate: 10, Concurrency: 1}}
+	RegisterHandlers(target)
+	server := httptest.NewServer(http.DefaultServeMux)
+	defer server.Close()
+
+	code, body := request(t, server, http.MethodGet, "/control/status", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"state":"running","rate":10,"concurrency":1`)
+
+	code, body = request(t, server, http.MethodPatch, "/control/traffic", `{"rate": 25.5, "concurrency": 4}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"rate":25.5,"concurrency":4`)
+
+	code, _ = request(t, server, http.MethodPatch, "/control/traffic", `{"rate": -1}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = request(t, server, http.MethodPatch, "/control/traffic", `{"qps": 1}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = request(t, server, http.MethodPatch, "/control/traffic?scenario=nope", `{"rate": 1}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, body = request(t, server, http.MethodPost, "/control/pause", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"state":"paused"`)
+	code, body = request(t, server, http.MethodPost, "/control/pause", "")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, `{"error":"already paused"}`, body)
+	code, _ = request(t, server, http.MethodPost, "/control/resume", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = request(t, server, http.MethodGet, "/control/stop", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	assert.False(t, target.stopped)
+	code, _ = request(t, server, http.MethodPost, "/control/stop", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, target.stopped)
+}
@@ -0,0 +1,134 @@
+package feeder
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+)
+
+// Modes in which the rows of a Feeder are handed out.
+const (
+	// Sequential hands out the rows in order, starting over after the last
+	// one unless the Feeder stops.
+	Sequential = "sequential"
+	// Random hands out a row at random for every request.
+	Random = "random"
+	// Unique hands out every row once, in order.
+	Unique = "unique"
+)
+
+// Feeder hands out the rows of a CSV file, one per request, as maps from the
+// column names of its header row to the values of the row. It is safe to use
+// concurrently.
+type Feeder struct {
+	name    string
+	columns []string
+	rows    []map[string]string
+	mode    string
+	stop    bool
+
+	mu   sync.Mutex
+	next int
+}
+
+// Load reads the CSV file at path. If stop is set, a sequential Feeder is
+// exhausted after its last row instead of starting over.
+func Load(path string, mode string, stop bool) (*Feeder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(path, file, mode, stop)
+}
+
+// Parse reads the CSV file of the given name from r.
+func Parse(name string, r io.Reader, mode string, stop bool) (*Feeder, error) {
+	switch mode {
+	case Sequential, Unique:
+	case Random:
+		if stop {
+			return nil, errors.New("a random feeder is never exhausted and can't stop the run")
+		}
+	default:
+		return nil, fmt.Errorf("invalid feeder mode '%s'", mode)
+	}
+
+	reader := csv.NewReader(r)
+	columns, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%s: the file is empty", name)
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	seen := make(map[string]bool)
+	for _, column := range columns {
+		if column == "" {
+			return nil, fmt.Errorf("%s: the header row has an empty column name", name)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("%s: duplicate column '%s'", name, column)
+		}
+		seen[column] = true
+	}
+
+	f := &Feeder{name: name, columns: columns, mode: mode, stop: stop}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			row[column] = record[i]
+		}
+		f.rows = append(f.rows, row)
+	}
+	if len(f.rows) == 0 {
+		return nil, fmt.Errorf("%s: the file has no rows", name)
+	}
+	return f, nil
+}
+
+// Columns returns the names of the columns, none if f is nil.
+func (f *Feeder) Columns() []string {
+	if f == nil {
+		return nil
+	}
+	return f.columns
+}
+
+// Len returns the number of rows.
+func (f *Feeder) Len() int {
+	return len(f.rows)
+}
+
+// String describes the Feeder, e.g. "users.csv (1000 rows, unique)".
+func (f *Feeder) String() string {
+	return fmt.Sprintf("%s (%d rows, %s)", f.name, len(f.rows), f.mode)
+}
+
+// Next returns the row of the next request, or false if the Feeder is
+// exhausted. The row must not be modified.
+func (f *Feeder) Next() (map[string]string, bool) {
+	if f.mode == Random {
+		return f.rows[rand.Intn(len(f.rows))], true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.next == len(f.rows) {
+		if f.mode == Unique || f.stop {
+			return nil, false
+		}
+		f.next = 0
+	}
+	row := f.rows[f.next]
+	f.next++
+	return row, true
+}
@@ -0,0 +1,79 @@
+package feeder
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+const users = "user_id,sku\n1,A\n2,B\n3,C\n"
+
+func ids(t *testing.T, f *Feeder, n int) []string {
+	var ids []string
+	for i := 0; i < n; i++ {
+		row, ok := f.Next()
+		if !ok {
+			break
+		}
+		ids = append(ids, row["user_id"])
+	}
+	return ids
+}
+
+func TestSequentialFeederStartsOver(t *testing.T) {
+	f, err := Parse("users.csv", strings.NewReader(users), Sequential, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user_id", "sku"}, f.Columns())
+	assert.Equal(t, []string{"1", "2", "3", "1", "2"}, ids(t, f, 5))
+}
+
+func TestSequentialFeederStops(t *testing.T) {
+	f, err := Parse("users.csv", strings.NewReader(users), Sequential, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, ids(t, f, 5))
+}
+
+func TestUniqueFeederIsExhausted(t *testing.T) {
+	f, err := Parse("users.csv", strings.NewReader(users), Unique, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, ids(t, f, 5))
+	_, ok := f.Next()
+	assert.False(t, ok)
+}
+
+func TestRandomFeeder(t *testing.T) {
+	f, err := Parse("users.csv", strings.NewReader(users), Random, false)
+	require.NoError(t, err)
+	for _, id := range ids(t, f, 20) {
+		assert.Contains(t, []string{"1", "2", "3"}, id)
+	}
+	row, _ := f.Next()
+	assert.Equal(t, map[string]string{"1": "A", "2": "B", "3": "C"}[row["user_id"]], row["sku"])
+}
+
+func TestParseFeederErrors(t *testing.T) {
+	for _, test := range []struct {
+		csv  string
+		mode string
+		stop bool
+		want string
+	}{
+		{"", Sequential, false, "users.csv: the file is empty"},
+		{"user_id\n", Sequential, false, "users.csv: the file has no rows"},
+		{"user_id,user_id\n1,2\n", Sequential, false, "users.csv: duplicate column 'user_id'"},
+		{"user_id,\n1,2\n", Sequential, false, "users.csv: the header row has an empty column name"},
+		{"user_id,sku\n1\n", Sequential, false, "users.csv: record on line 2: wrong number of fields"},
+		{users, "shuffle", false, "invalid feeder mode 'shuffle'"},
+		{users, Random, true, "a random feeder is never exhausted and can't stop the run"},
+	} {
+		_, err := Parse("users.csv", strings.NewReader(test.csv), test.mode, test.stop)
+		assert.EqualError(t, err, test.want)
+	}
+}
+
+func TestFeederString(t *testing.T) {
+	f, err := Parse("users.csv", strings.NewReader(users), Unique, false)
+	require.NoError(t, err)
+	assert.Equal(t, "users.csv (3 rows, unique)", f.String())
+}
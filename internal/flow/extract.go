@@ -0,0 +1,152 @@
+package flow
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Extraction extracts a named value from a response, from the JSON body, a
+// header or the first group of a regular expression matched on the body.
+type Extraction struct {
+	Name string
+	// Kind is json, header or regex, and Expr the path, header name or
+	// regular expression.
+	Kind string
+	Expr string
+	path []pathElement
+	re   *regexp.Regexp
+}
+
+// pathElement is the key of an object, or the index of an array if key is
+// empty.
+type pathElement struct {
+	key   string
+	index int
+}
+
+// NewExtraction checks the expression of an extraction of the given kind.
+func NewExtraction(name, kind, expr string) (Extraction, error) {
+	e := Extraction{Name: name, Kind: kind, Expr: expr}
+	var err error
+	switch kind {
+	case "json":
+		e.path, err = parsePath(expr)
+	case "header":
+		if expr == "" {
+			err = fmt.Errorf("empty header name")
+		}
+	case "regex":
+		e.re, err = regexp.Compile(expr)
+	default:
+		err = fmt.Errorf("unknown extraction '%s', expected json, header or regex", kind)
+	}
+	return e, err
+}
+
+// parsePath parses a JSON path such as $.items[0].id. The leading $ is
+// optional.
+func parsePath(expr string) ([]pathElement, error) {
+	rest := strings.TrimPrefix(expr, "$")
+	var path []pathElement
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			key := rest[1 : end+1]
+			if key == "" {
+				return nil, fmt.Errorf("invalid JSON path '%s': empty key", expr)
+			}
+			path = append(path, pathElement{key: key})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path '%s': missing ]", expr)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid JSON path '%s': invalid index '%s'", expr, rest[1:end])
+			}
+			path = append(path, pathElement{index: index})
+			rest = rest[end+1:]
+		default:
+			if len(path) == 0 && expr[0] != '$' {
+				// A path can start with a bare key, e.g. items[0].
+				rest = "." + rest
+				continue
+			}
+			return nil, fmt.Errorf("invalid JSON path '%s'", expr)
+		}
+	}
+	return path, nil
+}
+
+// Extract returns the value extracted from a response with the given header
+// and body.
+func (e Extraction) Extract(header http.Header, body []byte) (string, error) {
+	switch e.Kind {
+	case "header":
+		if values, ok := header[http.CanonicalHeaderKey(e.Expr)]; ok && len(values) > 0 {
+			return values[0], nil
+		}
+		return "", fmt.Errorf("no %s header", e.Expr)
+	case "regex":
+		match := e.re.FindSubmatch(body)
+		if match == nil {
+			return "", fmt.Errorf("no match for '%s'", e.Expr)
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+	default:
+		return e.extractJSON(body)
+	}
+}
+
+func (e Extraction) extractJSON(body []byte) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", fmt.Errorf("invalid JSON body: %s", err)
+	}
+	for _, element := range e.path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if element.key == "" {
+				return "", fmt.Errorf("no value at %s", e.Expr)
+			}
+			value = v[element.key]
+		case []interface{}:
+			if element.key != "" || element.index >= len(v) {
+				return "", fmt.Errorf("no value at %s", e.Expr)
+			}
+			value = v[element.index]
+		default:
+			return "", fmt.Errorf("no value at %s", e.Expr)
+		}
+	}
+	switch v := value.(type) {
+	case nil:
+		return "", fmt.Errorf("no value at %s", e.Expr)
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		// Objects and arrays are extracted as JSON.
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+}
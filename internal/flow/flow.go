@@ -0,0 +1,191 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/vspaz/slow_cooker/internal/validate"
+	"gopkg.in/yaml.v3"
+)
+
+// Step is one request of a flow. Zero values mean the step inherits the
+// corresponding command line flag.
+type Step struct {
+	Name    string
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    []byte
+	// ExpectStatus is the status code of a good response, any 2xx if zero.
+	ExpectStatus int
+	// Extract holds the values extracted from the response for the steps
+	// that follow.
+	Extract []Extraction
+}
+
+// rawStep is a step as written in the flow file.
+type rawStep struct {
+	Name         string            `yaml:"name"`
+	Method       string            `yaml:"method"`
+	URL          string            `yaml:"url"`
+	Headers      map[string]string `yaml:"headers"`
+	Body         *string           `yaml:"body"`
+	BodyFile     string            `yaml:"bodyFile"`
+	ExpectStatus int               `yaml:"expectStatus"`
+}
+
+var stepFields = []string{"name", "method", "url", "headers", "body", "bodyFile", "expectStatus", "extract"}
+
+// Load reads and validates the flow at path, which can be written in YAML or
+// JSON. All problems found are reported together, each prefixed with the
+// file name and line number it was found on.
+func Load(path string) ([]Step, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse validates a flow read from the named file.
+func Parse(name string, data []byte) ([]Step, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	if len(document.Content) == 0 {
+		return nil, fmt.Errorf("%s: the file is empty", name)
+	}
+
+	root := document.Content[0]
+	v := validator{Validator: validate.New(name), dir: filepath.Dir(name)}
+	if root.Kind != yaml.MappingNode {
+		v.Fail(root, "expected a mapping with a 'steps' list")
+		return nil, v.Err()
+	}
+	v.CheckFields(root, "the file", []string{"steps"})
+	stepsNode := validate.Field(root, "steps")
+	if stepsNode == nil || stepsNode.Kind != yaml.SequenceNode || len(stepsNode.Content) == 0 {
+		v.Fail(root, "expected a non-empty 'steps' list")
+		return nil, v.Err()
+	}
+
+	var steps []Step
+	names := make(map[string]bool)
+	for i, node := range stepsNode.Content {
+		step := v.step(fmt.Sprintf("step %d", i+1), node)
+		if node.Kind == yaml.MappingNode && names[step.Name] {
+			v.Fail(validate.Field(node, "name"), "step %d (%s): duplicate name", i+1, step.Name)
+		}
+		names[step.Name] = true
+		steps = append(steps, step)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// validator validates a flow, whose bodyFile paths are relative to dir.
+type validator struct {
+	*validate.Validator
+	dir string
+}
+
+// step validates a step, which is described as what in errors until its
+// name is known.
+func (v *validator) step(what string, node *yaml.Node) Step {
+	var raw rawStep
+	if !v.Decode(node, what, &raw) {
+		return Step{Name: what}
+	}
+	step := Step{
+		Name:         raw.Name,
+		Method:       raw.Method,
+		Headers:      raw.Headers,
+		ExpectStatus: raw.ExpectStatus,
+	}
+	if raw.Name != "" {
+		what = fmt.Sprintf("%s (%s)", what, raw.Name)
+	} else {
+		step.Name = what
+	}
+	v.CheckFields(node, what, stepFields)
+
+	if urlNode := validate.Field(node, "url"); urlNode == nil {
+		v.Fail(node, "%s: url is required", what)
+	} else if URL, err := validate.URL(raw.URL); err != nil {
+		v.Fail(urlNode, "%s: %s", what, err)
+	} else {
+		step.URL = URL
+	}
+
+	if raw.Body != nil && raw.BodyFile != "" {
+		v.Fail(validate.Field(node, "bodyFile"), "%s: body and bodyFile cannot be used together", what)
+	} else if raw.Body != nil {
+		step.Body = []byte(*raw.Body)
+	} else if raw.BodyFile != "" {
+		// Relative paths are resolved against the directory of the flow.
+		path := raw.BodyFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(v.dir, path)
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			v.Fail(validate.Field(node, "bodyFile"), "%s: %s", what, err)
+		}
+		step.Body = body
+	}
+
+	if raw.ExpectStatus != 0 && (raw.ExpectStatus < 100 || raw.ExpectStatus > 599) {
+		v.Fail(validate.Field(node, "expectStatus"), "%s: invalid expectStatus %d", what, raw.ExpectStatus)
+	}
+
+	if extractNode := validate.Field(node, "extract"); extractNode != nil {
+		if extractNode.Kind != yaml.MappingNode {
+			v.Fail(extractNode, "%s: extract: expected a mapping of names to extractions", what)
+		} else {
+			for i := 0; i+1 < len(extractNode.Content); i += 2 {
+				name, value := extractNode.Content[i], extractNode.Content[i+1]
+				extraction, err := v.extraction(name.Value, value)
+				if err != nil {
+					v.Fail(value, "%s: extract %s: %s", what, name.Value, err)
+					continue
+				}
+				step.Extract = append(step.Extract, extraction)
+			}
+		}
+	}
+	return step
+}
+
+// extraction validates the extraction of the named value, written as a
+// mapping with one of json, header or regex.
+func (v *validator) extraction(name string, node *yaml.Node) (Extraction, error) {
+	if !validName.MatchString(name) {
+		return Extraction{}, errors.New("names must start with a letter and hold only letters, digits and underscores")
+	}
+	if node.Kind != yaml.MappingNode || len(node.Content) != 2 || node.Content[1].Kind != yaml.ScalarNode {
+		return Extraction{}, errors.New("expected a mapping with one of json, header or regex")
+	}
+	return NewExtraction(name, node.Content[0].Value, node.Content[1].Value)
+}
+
+// validName matches the names of extracted values, which templates refer to
+// as {{.Values.NAME}}.
+var validName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// Values returns the names of the values extracted by the steps before the
+// given one.
+func Values(steps []Step, before int) []string {
+	var names []string
+	for _, step := range steps[:before] {
+		for _, extraction := range step.Extract {
+			names = append(names, extraction.Name)
+		}
+	}
+	return names
+}
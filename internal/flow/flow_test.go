@@ -0,0 +1,138 @@
+package flow
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestParseFlowOk(t *testing.T) {
+	steps, err := Parse("flow.yaml", []byte(`
+steps:
+  - name: login
+    method: POST
+    url: http://localhost:4140/login
+    body: '{"user": "{{.Row.user}}"}'
+    extract:
+      token: {json: $.token}
+      session: {header: X-Session}
+  - name: fetch
+    url: http://localhost:4140/items/{{.Values.token}}
+    headers:
+      Authorization: Bearer {{.Values.token}}
+    expectStatus: 200
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(steps))
+	assert.Equal(t, "login", steps[0].Name)
+	assert.Equal(t, "POST", steps[0].Method)
+	assert.Equal(t, []byte(`{"user": "{{.Row.user}}"}`), steps[0].Body)
+	assert.Equal(t, 2, len(steps[0].Extract))
+	assert.Equal(t, "token", steps[0].Extract[0].Name)
+	assert.Equal(t, "json", steps[0].Extract[0].Kind)
+	assert.Equal(t, "session", steps[0].Extract[1].Name)
+	assert.Equal(t, "header", steps[0].Extract[1].Kind)
+	assert.Equal(t, Step{
+		Name:         "fetch",
+		URL:          "http://localhost:4140/items/{{.Values.token}}",
+		Headers:      map[string]string{"Authorization": "Bearer {{.Values.token}}"},
+		ExpectStatus: 200,
+	}, steps[1])
+	assert.Nil(t, Values(steps, 0))
+	assert.Equal(t, []string{"token", "session"}, Values(steps, 1))
+}
+
+func TestParseFlowErrorsOk(t *testing.T) {
+	_, err := Parse("flow.yaml", []byte(`steps:
+  - name: first
+    url: localhost:4140
+    extract:
+      token: {xpath: //token}
+  - name: first
+    url: http://localhost:4140/
+    expectStatus: 42
+    extract:
+      1st: {regex: 'id=(\d+)'}
+      id: {regex: '('}
+  - method: GET
+`))
+	assert.EqualError(t, err, "flow.yaml:3: step 1 (first): invalid URL 'localhost:4140': Missing host\n"+
+		"flow.yaml:5: step 1 (first): extract token: unknown extraction 'xpath', expected json, header or regex\n"+
+		"flow.yaml:8: step 2 (first): invalid expectStatus 42\n"+
+		"flow.yaml:10: step 2 (first): extract 1st: names must start with a letter and hold only letters, digits and underscores\n"+
+		"flow.yaml:11: step 2 (first): extract id: error parsing regexp: missing closing ): `(`\n"+
+		"flow.yaml:6: step 2 (first): duplicate name\n"+
+		"flow.yaml:12: step 3: url is required")
+}
+
+func TestParseEmptyFlowOk(t *testing.T) {
+	_, err := Parse("flow.yaml", []byte(""))
+	assert.EqualError(t, err, "flow.yaml: the file is empty")
+	_, err = Parse("flow.yaml", []byte("steps: []"))
+	assert.EqualError(t, err, "flow.yaml:1: expected a non-empty 'steps' list")
+}
+
+func TestExtractJSONOk(t *testing.T) {
+	body := []byte(`{"token": "abc", "items": [{"id": 7, "ok": true, "tags": ["a"]}], "none": null}`)
+	for path, expected := range map[string]string{
+		"$.token":            "abc",
+		"token":              "abc",
+		"$.items[0].id":      "7",
+		"items[0].ok":        "true",
+		"$.items[0].tags":    `["a"]`,
+		"$.items[0]":         `{"id":7,"ok":true,"tags":["a"]}`,
+		"$":                  `{"items":[{"id":7,"ok":true,"tags":["a"]}],"none":null,"token":"abc"}`,
+		"$.items[0].tags[0]": "a",
+	} {
+		e, err := NewExtraction("value", "json", path)
+		assert.NoError(t, err)
+		value, err := e.Extract(nil, body)
+		assert.NoError(t, err, path)
+		assert.Equal(t, expected, value, path)
+	}
+	for _, path := range []string{"$.missing", "$.none", "$.items[1]", "$.token.length", "$.items.id"} {
+		e, err := NewExtraction("value", "json", path)
+		assert.NoError(t, err)
+		_, err = e.Extract(nil, body)
+		assert.EqualError(t, err, "no value at "+path)
+	}
+	e, _ := NewExtraction("value", "json", "$.token")
+	_, err := e.Extract(nil, []byte("<html>"))
+	assert.EqualError(t, err, "invalid JSON body: invalid character '<' looking for beginning of value")
+}
+
+func TestParseJSONPathErrorsOk(t *testing.T) {
+	for path, msg := range map[string]string{
+		"$..token":    "invalid JSON path '$..token': empty key",
+		"$.items[0":   "invalid JSON path '$.items[0': missing ]",
+		"$.items[-1]": "invalid JSON path '$.items[-1]': invalid index '-1'",
+		"$token":      "invalid JSON path '$token'",
+	} {
+		_, err := NewExtraction("value", "json", path)
+		assert.EqualError(t, err, msg)
+	}
+}
+
+func TestExtractHeaderAndRegexOk(t *testing.T) {
+	header := http.Header{"X-Session": {"s1"}}
+	e, _ := NewExtraction("session", "header", "x-session")
+	value, err := e.Extract(header, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "s1", value)
+	e, _ = NewExtraction("csrf", "header", "X-Csrf")
+	_, err = e.Extract(header, nil)
+	assert.EqualError(t, err, "no X-Csrf header")
+
+	body := []byte(`<input name="csrf" value="t0k3n">`)
+	e, _ = NewExtraction("csrf", "regex", `value="(\w+)"`)
+	value, err = e.Extract(nil, body)
+	assert.NoError(t, err)
+	assert.Equal(t, "t0k3n", value)
+	e, _ = NewExtraction("csrf", "regex", `t\d+k`)
+	value, err = e.Extract(nil, body)
+	assert.NoError(t, err)
+	assert.Equal(t, "t0k", value)
+	e, _ = NewExtraction("csrf", "regex", `id="(\w+)"`)
+	_, err = e.Extract(nil, body)
+	assert.EqualError(t, err, `no match for 'id="(\w+)"'`)
+}
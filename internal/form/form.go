@@ -0,0 +1,173 @@
+package form
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Encodings of the body of a Form.
+const (
+	// Multipart encodes the body as multipart/form-data, which files need.
+	Multipart = "multipart"
+	// URLEncoded encodes the body as application/x-www-form-urlencoded.
+	URLEncoded = "urlencoded"
+)
+
+// Field is a field of a form: a value, or a file if Path is set.
+type Field struct {
+	Name  string
+	Value string
+	// Path is the file whose Content is uploaded with the content type
+	// ContentType, guessed from its extension or content.
+	Path        string
+	ContentType string
+	Content     []byte
+}
+
+// ParseField parses a field written as NAME=VALUE, or NAME=@PATH to upload
+// the file at PATH, which is read.
+func ParseField(text string) (Field, error) {
+	name, value, ok := strings.Cut(text, "=")
+	if !ok || name == "" {
+		return Field{}, fmt.Errorf("invalid field '%s', expected NAME=VALUE or NAME=@PATH", text)
+	}
+	if !strings.HasPrefix(value, "@") {
+		return Field{Name: name, Value: value}, nil
+	}
+	path := value[1:]
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Field{}, err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	return Field{Name: name, Path: path, ContentType: contentType, Content: content}, nil
+}
+
+// IsFile reports whether the field uploads a file.
+func (f Field) IsFile() bool {
+	return f.Path != ""
+}
+
+// Form builds the bodies of requests from fields, whose values can change
+// from one body to the next. It is safe to use concurrently.
+type Form struct {
+	Fields   []Field
+	encoding string
+	// boundary separates the parts of multipart bodies, picked at random
+	// once for all of them.
+	boundary string
+}
+
+// New returns a form of fields with the given encoding, multipart if it
+// uploads files and urlencoded otherwise if empty.
+func New(fields []Field, encoding string) (*Form, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("no fields")
+	}
+	files := 0
+	for _, field := range fields {
+		if field.IsFile() {
+			files++
+		}
+	}
+	switch encoding {
+	case "":
+		encoding = URLEncoded
+		if files > 0 {
+			encoding = Multipart
+		}
+	case Multipart:
+	case URLEncoded:
+		if files > 0 {
+			return nil, errors.New("files can only be uploaded with multipart encoding")
+		}
+	default:
+		return nil, fmt.Errorf("unknown encoding '%s', expected multipart or urlencoded", encoding)
+	}
+	return &Form{
+		Fields:   fields,
+		encoding: encoding,
+		boundary: multipart.NewWriter(nil).Boundary(),
+	}, nil
+}
+
+// ContentType returns the Content-Type header of the bodies.
+func (f *Form) ContentType() string {
+	if f.encoding == Multipart {
+		return "multipart/form-data; boundary=" + f.boundary
+	}
+	return "application/x-www-form-urlencoded"
+}
+
+// Encode returns a body with the given values of the fields, one per field
+// in order, or with the values of the fields if values is nil. The values of
+// files are ignored.
+func (f *Form) Encode(values []string) []byte {
+	if values == nil {
+		values = make([]string, len(f.Fields))
+		for i, field := range f.Fields {
+			values[i] = field.Value
+		}
+	}
+	if f.encoding == URLEncoded {
+		encoded := make([]string, len(f.Fields))
+		for i, field := range f.Fields {
+			encoded[i] = url.QueryEscape(field.Name) + "=" + url.QueryEscape(values[i])
+		}
+		return []byte(strings.Join(encoded, "&"))
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	// The boundary is valid, being one picked by multipart.
+	_ = writer.SetBoundary(f.boundary)
+	for i, field := range f.Fields {
+		header := make(textproto.MIMEHeader)
+		if field.IsFile() {
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+				escapeQuotes(field.Name), escapeQuotes(filepath.Base(field.Path))))
+			header.Set("Content-Type", field.ContentType)
+		} else {
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(field.Name)))
+		}
+		// Writing to a bytes.Buffer doesn't fail.
+		part, _ := writer.CreatePart(header)
+		if field.IsFile() {
+			part.Write(field.Content)
+		} else {
+			part.Write([]byte(values[i]))
+		}
+	}
+	writer.Close()
+	return body.Bytes()
+}
+
+// String describes the form in the request info.
+func (f *Form) String() string {
+	names := make([]string, len(f.Fields))
+	for i, field := range f.Fields {
+		names[i] = field.Name
+		if field.IsFile() {
+			names[i] += "=@" + field.Path
+		}
+	}
+	contentType, _, _ := strings.Cut(f.ContentType(), ";")
+	return fmt.Sprintf("%s bodies of %s", contentType, strings.Join(names, ", "))
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,70 @@
+package form
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestURLEncodedOk(t *testing.T) {
+	f, err := New([]Field{{Name: "user", Value: "alice"}, {Name: "q", Value: "a&b c"}}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "application/x-www-form-urlencoded", f.ContentType())
+	assert.Equal(t, "user=alice&q=a%26b+c", string(f.Encode(nil)))
+	assert.Equal(t, "user=bob&q=", string(f.Encode([]string{"bob", ""})))
+	assert.Equal(t, "application/x-www-form-urlencoded bodies of user, q", f.String())
+}
+
+func TestMultipartOk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "avatar.png")
+	require.NoError(t, os.WriteFile(path, []byte("\x89PNG\r\n"), 0o600))
+	file, err := ParseField("avatar=@" + path)
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", file.ContentType)
+	title, err := ParseField("title=a=b")
+	require.NoError(t, err)
+	assert.Equal(t, Field{Name: "title", Value: "a=b"}, title)
+
+	f, err := New([]Field{title, file}, "")
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(f.ContentType())
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/form-data", mediaType)
+
+	reader := multipart.NewReader(strings.NewReader(string(f.Encode([]string{"Holiday", "ignored"}))), params["boundary"])
+	part, err := reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "title", part.FormName())
+	assert.Equal(t, "", part.FileName())
+	content, _ := io.ReadAll(part)
+	assert.Equal(t, "Holiday", string(content))
+	part, err = reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "avatar", part.FormName())
+	assert.Equal(t, "avatar.png", part.FileName())
+	assert.Equal(t, "image/png", part.Header.Get("Content-Type"))
+	content, _ = io.ReadAll(part)
+	assert.Equal(t, "\x89PNG\r\n", string(content))
+	_, err = reader.NextPart()
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "multipart/form-data bodies of title, avatar=@"+path, f.String())
+}
+
+func TestFormErrors(t *testing.T) {
+	_, err := ParseField("=value")
+	assert.EqualError(t, err, "invalid field '=value', expected NAME=VALUE or NAME=@PATH")
+	_, err = ParseField("name")
+	assert.EqualError(t, err, "invalid field 'name', expected NAME=VALUE or NAME=@PATH")
+	_, err = New(nil, "")
+	assert.EqualError(t, err, "no fields")
+	_, err = New([]Field{{Name: "a", Path: "a.txt"}}, URLEncoded)
+	assert.EqualError(t, err, "files can only be uploaded with multipart encoding")
+	_, err = New([]Field{{Name: "a"}}, "json")
+	assert.EqualError(t, err, "unknown encoding 'json', expected multipart or urlencoded")
+}
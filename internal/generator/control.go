@@ -0,0 +1,213 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/control"
+	"github.com/vspaz/slow_cooker/internal/hdrreport"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// controller gives the control API access to the runners that are currently
+// running: the only one, those of every scenario, or that of the current
+// stage of a plan.
+type controller struct {
+	mu          sync.Mutex
+	names       []string
+	runners     []*runner
+	interrupted chan<- os.Signal
+}
+
+// set replaces the runners that are controlled.
+func (c *controller) set(names []string, runners []*runner) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.names = names
+	c.runners = runners
+}
+
+// selected returns the names and runners of the given scenario, or all of
+// them if scenario is empty.
+func (c *controller) selected(scenario string) ([]string, []*runner, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if scenario == "" {
+		return c.names, c.runners, nil
+	}
+	for i, name := range c.names {
+		if name == scenario {
+			return c.names[i : i+1], c.runners[i : i+1], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w '%s'", control.ErrUnknownScenario, scenario)
+}
+
+func (c *controller) Status() []control.Status {
+	names, runners, _ := c.selected("")
+	statuses := []control.Status{}
+	for i, r := range runners {
+		r.do(func() {
+			statuses = append(statuses, r.status(names[i]))
+		})
+	}
+	return statuses
+}
+
+func (c *controller) Update(scenario string, update control.Update) error {
+	_, runners, err := c.selected(scenario)
+	if err != nil {
+		return err
+	}
+	if len(runners) > 1 {
+		return errors.New("several scenarios are running, pick one with ?scenario=NAME")
+	}
+	for _, r := range runners {
+		if update.Rate != nil && r.args.Search != nil {
+			return errors.New("the rate is managed by -search")
+		}
+		if update.Rate != nil && r.args.Timeline != nil {
+			return errors.New("the rate is managed by -replayTiming")
+		}
+		r.do(func() {
+			if update.Rate != nil {
+				r.setRate(*update.Rate)
+			}
+			if update.Concurrency != nil {
+				r.setConcurrency(*update.Concurrency)
+			}
+		})
+	}
+	return nil
+}
+
+func (c *controller) Pause(scenario string) error {
+	return c.each(scenario, (*runner).pause)
+}
+
+func (c *controller) Resume(scenario string) error {
+	return c.each(scenario, (*runner).resume)
+}
+
+// each calls f on the runners of the given scenario, or all of them. Runners
+// that are already in the requested state are only reported as an error if
+// a single one was selected.
+func (c *controller) each(scenario string, f func(r *runner) error) error {
+	_, runners, err := c.selected(scenario)
+	if err != nil {
+		return err
+	}
+	for _, r := range runners {
+		r.do(func() {
+			err = f(r)
+		})
+		if err != nil && len(runners) == 1 {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleSignals acts on the signals that change a run without ending it:
+// SIGUSR1 prints the summary so far, SIGUSR2 pauses or resumes the traffic
+// and SIGHUP reloads the URL list, requests and body from their files.
+func (c *controller) handleSignals(signals <-chan os.Signal) {
+	for sig := range signals {
+		switch sig {
+		case syscall.SIGUSR1:
+			c.printSummaries()
+		case syscall.SIGUSR2:
+			c.togglePause()
+		case syscall.SIGHUP:
+			c.reload()
+		}
+	}
+}
+
+func (c *controller) printSummaries() {
+	names, runners, _ := c.selected("")
+	for i, r := range runners {
+		r.do(func() {
+			if names[i] == "" {
+				fmt.Println("# summary so far")
+			} else {
+				fmt.Printf("# summary so far: %s\n", names[i])
+			}
+			r.printSummary()
+		})
+	}
+}
+
+// togglePause pauses all runners unless they are all paused already, in
+// which case they resume.
+func (c *controller) togglePause() {
+	_, runners, _ := c.selected("")
+	running := false
+	for _, r := range runners {
+		r.do(func() {
+			running = running || !r.paused()
+		})
+	}
+	if running {
+		c.each("", (*runner).pause)
+		fmt.Println("# paused")
+	} else {
+		c.each("", (*runner).resume)
+		fmt.Println("# resumed")
+	}
+}
+
+func (c *controller) reload() {
+	_, runners, _ := c.selected("")
+	for _, r := range runners {
+		r.do(r.reload)
+	}
+}
+
+func (c *controller) Stop() {
+	// Stopping is handled like a SIGINT.
+	select {
+	case c.interrupted <- syscall.SIGINT:
+	default:
+	}
+}
+
+// status describes the runner to the control API. It must be called from the
+// event loop of the runner.
+func (r *runner) status(name string) control.Status {
+	state := "running"
+	if r.paused() {
+		state = "paused"
+	}
+	elapsed := time.Since(r.start)
+	return control.Status{
+		Name:        name,
+		State:       state,
+		Rate:        r.schedule.Profile().Rate(elapsed),
+		Concurrency: len(r.workers),
+		Iteration:   r.iteration,
+		Requests:    atomic.LoadUint64(&r.reqID),
+		Elapsed:     elapsed.Seconds(),
+		Latency:     hdrreport.NewQuantiles(r.globalHist),
+	}
+}
+
+// reload reloads the URL list, requests, body and headers of the runner from
+// their files. It must be called from the event loop of the runner.
+func (r *runner) reload() {
+	files, err := r.args.Reload()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%sreload failed: %s\n", r.prefix, err)
+		return
+	}
+	if len(files) == 0 {
+		fmt.Printf("%s# nothing to reload\n", r.prefix)
+		return
+	}
+	r.requestGenerator.SetTargets(r.args)
+	fmt.Printf("%s# reloaded %s\n", r.prefix, strings.Join(files, ", "))
+}
@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/templating"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// flowStats are the outcomes of the flows of a whole run, the durations of
+// those that completed and the stats of each of their steps.
+type flowStats struct {
+	completed uint64
+	aborted   uint64
+	hist      *hdrhistogram.Histogram
+	steps     map[string]*outcomeStats
+}
+
+// sendFlow sends the steps of -flow in order, see sendSteps.
+func (r *runner) sendFlow(client *http.Client, vars templating.Vars, bodyBuffer []byte, scheduledAt time.Time) {
+	r.sendSteps(r.requestGenerator.allTargets(), client, vars, bodyBuffer, scheduledAt, false)
+}
+
+// sendSteps sends targets in order, each rendered with vars and the values
+// extracted from the responses to the targets before it. It stops at the
+// first step that fails or gets a bad response, or when the run is stopped
+// unless the steps are those of a session, and returns the values extracted
+// and whether all steps succeeded.
+func (r *runner) sendSteps(
+	targets []*target,
+	client *http.Client,
+	vars templating.Vars,
+	bodyBuffer []byte,
+	scheduledAt time.Time,
+	session bool,
+) (map[string]string, bool) {
+	start := scheduledAt
+	if start.IsZero() {
+		start = time.Now()
+	}
+	values := make(map[string]string, len(vars.Values))
+	for name, value := range vars.Values {
+		values[name] = value
+	}
+	vars.Values = values
+	for i, t := range targets {
+		if i > 0 && !session {
+			select {
+			case <-r.stop:
+				return values, false
+			default:
+			}
+			vars.RequestID = atomic.AddUint64(&r.reqID, 1)
+		}
+		if i > 0 {
+			// Only the first step can be late on schedule.
+			scheduledAt = time.Time{}
+		}
+		result := r.requestGenerator.doRequest(t, client, vars, false, nil, bodyBuffer, scheduledAt)
+		result.Session = session
+		if result.Err != nil || !result.Good {
+			result.FlowAborted = !session
+			r.received <- result
+			return values, false
+		}
+		for name, value := range result.Values {
+			values[name] = value
+		}
+		if i == len(targets)-1 && !session {
+			result.FlowDuration = time.Since(start)
+		}
+		r.received <- result
+	}
+	return values, true
+}
+
+// recordFlow adds a response to the stats of its step and of the flow it
+// completed or aborted. It does nothing without -flow.
+func (r *runner) recordFlow(managedResp *MeasuredResponse, latency int64) {
+	if r.args.Flow == nil {
+		return
+	}
+	stats, ok := r.flowStats.steps[managedResp.Target]
+	if !ok {
+		stats = r.newOutcomeStats()
+		r.flowStats.steps[managedResp.Target] = stats
+	}
+	stats.record(managedResp, latency)
+	if managedResp.FlowAborted {
+		r.flowStats.aborted++
+	} else if managedResp.FlowDuration > 0 {
+		r.flowStats.completed++
+		r.flowStats.hist.RecordValue(managedResp.FlowDuration.Nanoseconds() / r.latencyDurNS)
+	}
+}
+
+// printFlowStats prints the outcomes and latency quantiles of each step of
+// -flow, in order, then the number of flows that completed or were aborted
+// and the duration quantiles of those that completed.
+func (r *runner) printFlowStats() {
+	width := len("step")
+	for _, step := range r.args.Flow {
+		width = max(width, len(step.Name))
+	}
+	fmt.Printf("# %-*s good/b/f [p50 p95 p99  p999]\n", width, "step")
+	for _, step := range r.args.Flow {
+		stats, ok := r.flowStats.steps[step.Name]
+		if !ok {
+			continue
+		}
+		stats.print(width, step.Name)
+	}
+	hist := r.flowStats.hist
+	fmt.Printf("# flows completed/aborted %d/%d, duration [p50 p95 p99  p999] [%3d %3d %3d %4d ]\n",
+		r.flowStats.completed, r.flowStats.aborted,
+		hist.ValueAtQuantile(50),
+		hist.ValueAtQuantile(95),
+		hist.ValueAtQuantile(99),
+		hist.ValueAtQuantile(99.9))
+}
@@ -0,0 +1,77 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// outcomeStats are the outcomes and latencies of the requests of a whole run
+// sent with one of the Host headers of -host, or to one of the steps of -flow.
+type outcomeStats struct {
+	good   uint64
+	bad    uint64
+	failed uint64
+	hist   *hdrhistogram.Histogram
+}
+
+func (r *runner) newOutcomeStats() *outcomeStats {
+	return &outcomeStats{hist: hdrhistogram.New(0, r.globalHist.HighestTrackableValue(), 3)}
+}
+
+// record adds a response with the given latency to the stats.
+func (stats *outcomeStats) record(managedResp *MeasuredResponse, latency int64) {
+	switch {
+	case managedResp.Err != nil:
+		stats.failed++
+		return
+	case managedResp.Good:
+		stats.good++
+	default:
+		stats.bad++
+	}
+	stats.hist.RecordValue(latency)
+}
+
+// print prints the outcomes and latency quantiles of the stats in a column
+// of the given width named name.
+func (stats *outcomeStats) print(width int, name string) {
+	fmt.Printf("# %-*s %d/%d/%d [%3d %3d %3d %4d ]\n",
+		width, name,
+		stats.good, stats.bad, stats.failed,
+		stats.hist.ValueAtQuantile(50),
+		stats.hist.ValueAtQuantile(95),
+		stats.hist.ValueAtQuantile(99),
+		stats.hist.ValueAtQuantile(99.9))
+}
+
+// recordHost adds a response to the stats of its Host header. It does nothing
+// unless -host has several values.
+func (r *runner) recordHost(managedResp *MeasuredResponse, latency int64) {
+	if len(r.args.Host) < 2 {
+		return
+	}
+	stats, ok := r.hostStats[managedResp.Host]
+	if !ok {
+		stats = r.newOutcomeStats()
+		r.hostStats[managedResp.Host] = stats
+	}
+	stats.record(managedResp, latency)
+}
+
+// printHostStats prints the outcomes and latency quantiles of the requests
+// sent with each Host header, in the order of -host.
+func (r *runner) printHostStats() {
+	width := len("host")
+	for _, host := range r.args.Host {
+		width = max(width, len(host))
+	}
+	fmt.Printf("# %-*s good/b/f [p50 p95 p99  p999]\n", width, "host")
+	for _, host := range r.args.Host {
+		stats, ok := r.hostStats[host]
+		if !ok {
+			continue
+		}
+		stats.print(width, host)
+	}
+}
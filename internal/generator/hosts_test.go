@@ -0,0 +1,34 @@
+package generator
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/vspaz/slow_cooker/internal/cli"
+	"testing"
+	"time"
+)
+
+func TestRecordHostStats(t *testing.T) {
+	r := newRunner(&cli.Args{
+		LatencyDuration: time.Millisecond,
+		Method:          "GET",
+		Host:            []string{"web_a", "web_b"},
+		HostWeights:     []float64{1, 2},
+		DstUrls:         []string{"http://a.test/"},
+	})
+	r.record(&MeasuredResponse{Host: "web_a", Code: 200, Good: true, Latency: 5 * time.Millisecond})
+	r.record(&MeasuredResponse{Host: "web_a", Code: 503, Latency: 9 * time.Millisecond})
+	r.record(&MeasuredResponse{Host: "web_b", Err: errors.New("connection refused")})
+
+	assert.Equal(t, uint64(1), r.hostStats["web_a"].good)
+	assert.Equal(t, uint64(1), r.hostStats["web_a"].bad)
+	assert.Equal(t, int64(9), r.hostStats["web_a"].hist.Max())
+	assert.Equal(t, uint64(1), r.hostStats["web_b"].failed)
+	assert.Equal(t, int64(0), r.hostStats["web_b"].hist.TotalCount())
+}
+
+func TestRecordHostStatsNeedsSeveralHosts(t *testing.T) {
+	r := newRunner(&cli.Args{LatencyDuration: time.Millisecond, Host: []string{""}, DstUrls: []string{"http://a.test/"}})
+	r.record(&MeasuredResponse{Code: 200, Good: true})
+	assert.Empty(t, r.hostStats)
+}
@@ -2,29 +2,47 @@ package generator
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
-	"fmt"
+	"github.com/vspaz/slow_cooker/internal/auth"
 	"github.com/vspaz/slow_cooker/internal/cli"
+	"github.com/vspaz/slow_cooker/internal/signing"
+	"github.com/vspaz/slow_cooker/internal/templating"
+	"github.com/vspaz/slow_cooker/internal/weighted"
 	"hash"
 	"io"
-	"math/rand"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptrace"
-	"os"
 	"strconv"
+	"sync"
 	"time"
 )
 
 type RequestGenerator struct {
 	httpClient *http.Client
-	NoReuse    bool
-	HashValue  uint64
-	Method     string
-	Headers    map[string]string
-	Hosts      []string
-	Urls       []string
-	Body       []byte
+	// ctx is the context of every request, cancelled to abandon the requests
+	// in flight.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	NoReuse   bool
+	HashValue uint64
+	Hosts     []string
+	// hostChooser picks the Host header of each request.
+	hostChooser *weighted.Chooser
+	// mu guards targets, which can be replaced while requests are being
+	// sent, and chooser which picks them by weight.
+	mu      sync.RWMutex
+	targets []*target
+	chooser *weighted.Chooser
+	// auth, if set, sets the credentials of every request.
+	auth auth.Provider
+	// signer, if set, signs every request once its body is known.
+	signer signing.Signer
+	// setup and teardown are the steps of -userSetup and -userTeardown.
+	setup    []*target
+	teardown []*target
 }
 
 func NewRequestGenerator(args *cli.Args) *RequestGenerator {
@@ -39,61 +57,207 @@ func NewRequestGenerator(args *cli.Args) *RequestGenerator {
 		TLSHandshakeTimeout: 5 * time.Second,
 		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
 	}
+	ctx, cancel := context.WithCancel(context.Background())
+	targets := newTargets(args)
+	hostWeights := args.HostWeights
+	if hostWeights == nil {
+		// Hosts without weights are picked uniformly.
+		for range args.Host {
+			hostWeights = append(hostWeights, 1)
+		}
+	}
 	return &RequestGenerator{
 		httpClient: &http.Client{
 			Timeout:   args.ClientTimeout,
 			Transport: &tr,
 		},
-		NoReuse:   args.NoReuse,
-		HashValue: args.HashValue,
-		Method:    args.Method,
-		Headers:   args.Headers,
-		Hosts:     args.Host,
-		Urls:      args.DstUrls,
-		Body:      args.Data,
+		ctx:         ctx,
+		cancel:      cancel,
+		NoReuse:     args.NoReuse,
+		HashValue:   args.HashValue,
+		Hosts:       args.Host,
+		hostChooser: weighted.New(hostWeights),
+		targets:     targets,
+		chooser:     newChooser(targets),
+		auth:        args.Auth,
+		signer:      args.Signer,
+		setup:       newSessionTargets(args, "setup", args.UserSetup, nil),
+		teardown:    newSessionTargets(args, "teardown", args.UserTeardown, args.SessionValues()),
+	}
+}
+
+// newUserClient returns a client with its own cookie jar, sharing the
+// connections of the others.
+func (c *RequestGenerator) newUserClient() *http.Client {
+	// New never fails without options.
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Timeout:   c.httpClient.Timeout,
+		Transport: c.httpClient.Transport,
+		Jar:       jar,
 	}
 }
 
 // MeasuredResponse holds metadata about the response
 // we receive from the server under test.
 type MeasuredResponse struct {
-	Sz              uint64
-	Code            int
+	// Target is the name of the target the request was sent to.
+	Target string
+	// Host is the Host header of the request, if it was set by -host.
+	Host string
+	Sz   uint64
+	Code int
+	// Good is set if Code is the expected status code.
+	Good            bool
 	Latency         time.Duration
 	Timeout         bool
 	FailedHashCheck bool
 	Err             error
+	// Values are the values extracted from a good response to a step of
+	// -flow.
+	Values map[string]string
+	// FlowDuration is set on the response to the last step of a flow that
+	// completed, to the time since its first step was sent.
+	FlowDuration time.Duration
+	// FlowAborted is set on the response to the step that ended its flow
+	// early.
+	FlowAborted bool
+	// Session is set on the responses to the steps of -userSetup and
+	// -userTeardown, which are kept out of the stats of the workload.
+	Session bool
 }
 
-func (c *RequestGenerator) parametrizeRequest(offset int, reqID uint64) *http.Request {
-	req, err := http.NewRequest(c.Method, c.Urls[offset], bytes.NewBuffer(c.Body))
-	req.Close = c.NoReuse
+// SetTargets replaces the URLs, headers and bodies of the requests sent from
+// now on by those of args.
+func (c *RequestGenerator) SetTargets(args *cli.Args) {
+	targets := newTargets(args)
+	chooser := newChooser(targets)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets = targets
+	c.chooser = chooser
+}
+
+func newChooser(targets []*target) *weighted.Chooser {
+	weights := make([]float64, len(targets))
+	for i, t := range targets {
+		weights[i] = t.weight
+	}
+	return weighted.New(weights)
+}
+
+// PickWeighted returns a target at random, in proportion to the weights of
+// the targets.
+func (c *RequestGenerator) PickWeighted() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.chooser.Pick()
+}
+
+// CancelRequests abandons the requests in flight, which fail right away.
+func (c *RequestGenerator) CancelRequests() {
+	c.cancel()
+}
+
+// TargetCount returns the number of different requests that are sent.
+func (c *RequestGenerator) TargetCount() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.targets)
+}
+
+// allTargets returns the targets in order.
+func (c *RequestGenerator) allTargets() []*target {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.targets
+}
+
+// target returns the target at offset.
+func (c *RequestGenerator) target(offset int) *target {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	// The targets may have been reloaded since offset was picked.
+	return c.targets[offset%len(c.targets)]
+}
+
+func (c *RequestGenerator) parametrizeRequest(target *target, host string, vars templating.Vars) (*http.Request, error) {
+	url, header, body, err := target.render(vars)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(c.ctx, target.method, url, bytes.NewBuffer(body))
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		fmt.Fprintf(os.Stderr, "\n")
+		return nil, err
 	}
-	host := c.Hosts[rand.Intn(len(c.Hosts))]
+	req.Close = c.NoReuse
 	if host != "" {
 		req.Host = host
 	}
-	req.Header.Add("Sc-Req-Id", strconv.FormatUint(reqID, 10))
-	for k, v := range c.Headers {
-		req.Header.Add(k, v)
+	req.Header.Add("Sc-Req-Id", strconv.FormatUint(vars.RequestID, 10))
+	for name, values := range header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if c.auth != nil {
+		if err := c.auth.Authorize(req); err != nil {
+			return nil, err
+		}
 	}
-	return req
+	// Signers come last, to sign the request as it is sent.
+	if c.signer != nil {
+		if err := c.signer.Sign(req, body, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
 }
 
+// DoRequest sends a request to the target at offset with client, or the
+// shared client if nil, and sends the response to received.
 func (c *RequestGenerator) DoRequest(
 	offset int,
-	reqID uint64,
+	client *http.Client,
+	vars templating.Vars,
 	checkHash bool,
 	hasher hash.Hash64,
 	received chan *MeasuredResponse,
 	bodyBuffer []byte,
+	scheduledAt time.Time,
 ) {
-	req := c.parametrizeRequest(offset, reqID)
+	received <- c.doRequest(c.target(offset), client, vars, checkHash, hasher, bodyBuffer, scheduledAt)
+}
+
+// doRequest sends a request to target with client, or the shared client if
+// nil, and returns the response to it.
+func (c *RequestGenerator) doRequest(
+	target *target,
+	client *http.Client,
+	vars templating.Vars,
+	checkHash bool,
+	hasher hash.Hash64,
+	bodyBuffer []byte,
+	scheduledAt time.Time,
+) *MeasuredResponse {
+	if client == nil {
+		client = c.httpClient
+	}
+	host := c.Hosts[c.hostChooser.Pick()]
+	req, err := c.parametrizeRequest(target, host, vars)
+	result := &MeasuredResponse{Target: target.name, Host: host}
+	if err != nil {
+		result.Err = err
+		return result
+	}
 	var elapsed time.Duration
-	start := time.Now()
+	// In open-loop mode latency is measured from the time the request was
+	// supposed to be sent, so that any queueing delay on our side or the
+	// backend's is accounted for instead of silently omitted.
+	start := scheduledAt
+	if start.IsZero() {
+		start = time.Now()
+	}
 
 	trace := &httptrace.ClientTrace{
 		GotFirstResponseByte: func() {
@@ -102,38 +266,35 @@ func (c *RequestGenerator) DoRequest(
 	}
 
 	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
-	response, err := c.httpClient.Do(req)
+	response, err := client.Do(req)
 
 	if err != nil {
-		received <- &MeasuredResponse{Err: err}
+		result.Err = err
 	} else {
 		defer response.Body.Close()
-		if !checkHash {
+		result.Code = response.StatusCode
+		result.Good = target.isGood(response.StatusCode)
+		result.Latency = elapsed
+		if !checkHash && target.extract == nil {
 			if sz, err := io.CopyBuffer(io.Discard, response.Body, bodyBuffer); err == nil {
-
-				received <- &MeasuredResponse{
-					Sz:      uint64(sz),
-					Code:    response.StatusCode,
-					Latency: elapsed}
+				result.Sz = uint64(sz)
 			} else {
-				received <- &MeasuredResponse{Err: err}
+				result.Err = err
 			}
 		} else {
 			if byteArray, err := io.ReadAll(response.Body); err != nil {
-				received <- &MeasuredResponse{Err: err}
+				result.Err = err
 			} else {
-				hasher.Write(byteArray)
-				sum := hasher.Sum64()
-				failedHashCheck := false
-				if c.HashValue != sum {
-					failedHashCheck = true
+				result.Sz = uint64(len(byteArray))
+				if checkHash {
+					hasher.Write(byteArray)
+					result.FailedHashCheck = c.HashValue != hasher.Sum64()
+				}
+				if target.extract != nil && result.Good {
+					result.Values, result.Err = target.extractValues(response.Header, byteArray)
 				}
-				received <- &MeasuredResponse{
-					Sz:              uint64(len(byteArray)),
-					Code:            response.StatusCode,
-					Latency:         elapsed,
-					FailedHashCheck: failedHashCheck}
 			}
 		}
 	}
+	return result
 }
@@ -1 +1,73 @@
 package generator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vspaz/slow_cooker/internal/auth"
+	"github.com/vspaz/slow_cooker/internal/signing"
+	"github.com/vspaz/slow_cooker/internal/templating"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParametrizeRequestAuthorizes(t *testing.T) {
+	args := newTestArgs("http://a.test/")
+	args.Headers = http.Header{"Authorization": {"Bearer expired"}}
+	args.Auth, _ = auth.NewBasic("alice:secret")
+	c := NewRequestGenerator(args)
+	req, err := c.parametrizeRequest(c.target(0), "", templating.Vars{RequestID: 1})
+	require.NoError(t, err)
+	user, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "alice", user)
+	assert.Equal(t, "secret", password)
+	assert.Equal(t, []string{"1"}, req.Header["Sc-Req-Id"])
+}
+
+func TestParametrizeRequestSendsRepeatedHeaders(t *testing.T) {
+	args := newTestArgs("http://a.test/")
+	args.Templates = true
+	args.Headers = http.Header{
+		"Accept":            {"text/html, application/json;q=0.9"},
+		"If-Modified-Since": {"Wed, 21 Oct 2015 07:28:00 GMT"},
+		"X-Tag":             {"a", "{{.RequestID}}"},
+	}
+	c := NewRequestGenerator(args)
+	req, err := c.parametrizeRequest(c.target(0), "", templating.Vars{RequestID: 7})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"text/html, application/json;q=0.9"}, req.Header["Accept"])
+	assert.Equal(t, []string{"Wed, 21 Oct 2015 07:28:00 GMT"}, req.Header["If-Modified-Since"])
+	assert.Equal(t, []string{"a", "7"}, req.Header["X-Tag"])
+}
+
+// bodySigner signs requests with their body, to check that it is rendered
+// before they are signed.
+type bodySigner struct{}
+
+func (bodySigner) Sign(req *http.Request, body []byte, now time.Time) error {
+	req.Header.Set("X-Signed-Body", string(body))
+	return nil
+}
+
+func (bodySigner) String() string {
+	return "body"
+}
+
+func TestParametrizeRequestSignsRenderedBody(t *testing.T) {
+	args := newTestArgs("http://a.test/")
+	args.Templates = true
+	args.Data = []byte("request {{.RequestID}}")
+	args.Signer = bodySigner{}
+	c := NewRequestGenerator(args)
+	req, err := c.parametrizeRequest(c.target(0), "", templating.Vars{RequestID: 7})
+	require.NoError(t, err)
+	assert.Equal(t, "request 7", req.Header.Get("X-Signed-Body"))
+
+	args.Signer, err = signing.NewSigV4("execute-api", "eu-west-1", "AKIDEXAMPLE", "secret", "")
+	require.NoError(t, err)
+	c = NewRequestGenerator(args)
+	req, err = c.parametrizeRequest(c.target(0), "", templating.Vars{RequestID: 7})
+	require.NoError(t, err)
+	assert.Regexp(t, `^AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/\d{8}/eu-west-1/execute-api/aws4_request, SignedHeaders=host;sc-req-id;x-amz-date, Signature=[0-9a-f]{64}$`, req.Header.Get("Authorization"))
+}
@@ -0,0 +1,112 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/ring"
+	"github.com/vspaz/slow_cooker/internal/window"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// intervalStats are the stats of one reporting interval.
+type intervalStats struct {
+	time            time.Time
+	iteration       uint64
+	good            uint64
+	bad             uint64
+	failed          uint64
+	target          float64
+	rate            float64
+	minValue        int64
+	maxValue        int64
+	failedHashCheck int64
+	hist            *hdrhistogram.Histogram
+	warmup          bool
+	paused          bool
+}
+
+// percentAchieved returns the good and bad requests as a percentage of the
+// traffic target.
+func (s *intervalStats) percentAchieved() int {
+	totalTrafficTarget := math.Round(s.target)
+	if totalTrafficTarget == 0 {
+		return 100
+	}
+	return int(math.Min((((float64(s.good) + float64(s.bad)) /
+		totalTrafficTarget) * 100), 100))
+}
+
+// add adds the stats of another runner's interval to s.
+func (s *intervalStats) add(other *intervalStats) {
+	if other.good+other.bad > 0 && (s.good+s.bad == 0 || other.minValue < s.minValue) {
+		s.minValue = other.minValue
+	}
+	if other.maxValue > s.maxValue {
+		s.maxValue = other.maxValue
+	}
+	s.good += other.good
+	s.bad += other.bad
+	s.failed += other.failed
+	s.target += other.target
+	s.rate += other.rate
+	s.failedHashCheck += other.failedHashCheck
+	s.hist.Merge(other.hist)
+	s.warmup = s.warmup || other.warmup
+	s.paused = s.paused || other.paused
+}
+
+// printHeader prints the column names of the interval lines, which are
+// preceded by prefix.
+func printHeader(prefix string, interval time.Duration) {
+	// The time portion of the header can change due to timezone.
+	timeLen := len(time.Now().Format(time.RFC3339))
+	timePadding := strings.Repeat(" ", timeLen-len("# "))
+	intLen := len(fmt.Sprintf("%s", interval))
+	intPadding := strings.Repeat(" ", intLen-2)
+
+	fmt.Printf("# %s%s iter   good/b/f t   goal%% rate %s minValue [p50 p95 p99  p999]  maxValue bhash change\n", prefix, timePadding, intPadding)
+}
+
+// print prints the interval line, preceded by prefix, and records its p99
+// in latencyHistory.
+func (s *intervalStats) print(prefix string, interval time.Duration, latencyHistory *ring.IntRing) {
+	lastP99 := int(s.hist.ValueAtQuantile(99))
+	// We want the change indicator to be based on
+	// how far away the current value is from what
+	// we've seen historically. This is why we call
+	// CalculateChangeIndicator() first and then Push()
+	changeIndicator := window.CalculateChangeIndicator(latencyHistory.Items, lastP99)
+	latencyHistory.Push(lastP99)
+
+	marker := ""
+	if s.warmup {
+		marker += " warmup"
+	}
+	if s.paused {
+		marker += " paused"
+	}
+
+	fmt.Printf("%s%s %4d %6d/%1d/%1d %d %3d%% %4s %s %3d [%3d %3d %3d %4d ] %4d %6d %s%s\n",
+		prefix,
+		s.time.Format(time.RFC3339),
+		s.iteration,
+		s.good,
+		s.bad,
+		s.failed,
+		int(math.Round(s.target)),
+		s.percentAchieved(),
+		formatRate(s.rate),
+		interval,
+		s.minValue,
+		s.hist.ValueAtQuantile(50),
+		s.hist.ValueAtQuantile(95),
+		s.hist.ValueAtQuantile(99),
+		s.hist.ValueAtQuantile(999),
+		s.maxValue,
+		s.failedHashCheck,
+		changeIndicator,
+		marker)
+}
@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// picker returns the target of the next request of a request thread.
+type picker func() int
+
+// newPicker returns the picker of a request thread for -urlOrder.
+func (r *runner) newPicker(workerID int) picker {
+	switch r.args.UrlOrder {
+	case "random":
+		return func() int {
+			return rand.Intn(r.requestGenerator.TargetCount())
+		}
+	case "shuffle":
+		return r.shuffle.next
+	case "weighted":
+		return r.requestGenerator.PickWeighted
+	}
+	return r.sequentialPicker(workerID)
+}
+
+// sequentialPicker walks the targets from one given to the request thread,
+// striding over those of the other threads, so that all targets are sent
+// to in turn. The targets are counted through the RequestGenerator, as they
+// may be reloaded while request threads start.
+func (r *runner) sequentialPicker(workerID int) picker {
+	offset := workerID % r.requestGenerator.TargetCount()
+	next := offset
+	return func() int {
+		current := next
+		next += r.stride
+		if next >= r.requestGenerator.TargetCount() {
+			next = offset
+		}
+		return current
+	}
+}
+
+// shuffler hands out the targets in a random order, reshuffled once all of
+// them were handed out. It is shared by all request threads.
+type shuffler struct {
+	mu    sync.Mutex
+	count func() int
+	order []int
+}
+
+func (s *shuffler) next() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.order) == 0 {
+		s.order = rand.Perm(s.count())
+	}
+	next := s.order[0]
+	s.order = s.order[1:]
+	return next
+}
@@ -0,0 +1,76 @@
+package generator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/vspaz/slow_cooker/internal/cli"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func newOrderTestRunner(order string, urls ...string) *runner {
+	args := &cli.Args{LatencyDuration: 1, Method: "GET", UrlOrder: order, DstUrls: urls}
+	return newRunner(args)
+}
+
+func TestSequentialPickerStridesOverOtherThreads(t *testing.T) {
+	r := newOrderTestRunner("sequential", "http://a.test/", "http://b.test/", "http://c.test/", "http://d.test/")
+	r.stride = 2
+	first, second := r.newPicker(0), r.newPicker(1)
+	var picked [2][]int
+	for i := 0; i < 4; i++ {
+		picked[0] = append(picked[0], first())
+		picked[1] = append(picked[1], second())
+	}
+	assert.Equal(t, []int{0, 2, 0, 2}, picked[0])
+	assert.Equal(t, []int{1, 3, 1, 3}, picked[1])
+}
+
+func TestSequentialPickersWhileReloading(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("http://a.test/\nhttp://b.test/\n"), 0o600))
+	r := newOrderTestRunner("sequential", "http://a.test/", "http://b.test/")
+	r.args.UrlSource = "@" + path
+	r.stride = 1
+	// Request threads start and pick targets while the event loop reloads
+	// them, which -race checks.
+	var wg sync.WaitGroup
+	for workerID := 0; workerID < 8; workerID++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			pick := r.newPicker(workerID)
+			for i := 0; i < 100; i++ {
+				assert.Less(t, pick(), 2)
+			}
+		}(workerID)
+	}
+	for i := 0; i < 20; i++ {
+		r.reload()
+	}
+	wg.Wait()
+}
+
+func TestShufflePickerSendsToAllTargetsEachPass(t *testing.T) {
+	r := newOrderTestRunner("shuffle", "http://a.test/", "http://b.test/", "http://c.test/")
+	first, second := r.newPicker(0), r.newPicker(1)
+	for pass := 0; pass < 3; pass++ {
+		picked := []int{first(), second(), first()}
+		sort.Ints(picked)
+		assert.Equal(t, []int{0, 1, 2}, picked)
+	}
+}
+
+func TestRandomPickersStayInRange(t *testing.T) {
+	for _, order := range []string{"random", "weighted"} {
+		r := newOrderTestRunner(order, "http://a.test/", "http://b.test/")
+		pick := r.newPicker(0)
+		seen := make(map[int]bool)
+		for i := 0; i < 100; i++ {
+			seen[pick()] = true
+		}
+		assert.Equal(t, map[int]bool{0: true, 1: true}, seen, order)
+	}
+}
@@ -0,0 +1,89 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/cli"
+	"github.com/vspaz/slow_cooker/internal/hdrreport"
+	"github.com/vspaz/slow_cooker/internal/plan"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// runPlan runs the stages of a plan one after the other, printing a summary
+// for each of them and a combined one at the end. It returns the combined
+// latency histogram.
+func runPlan(args *cli.Args, interrupted <-chan os.Signal, ctrl *controller) *hdrhistogram.Histogram {
+	dayInTimeUnits := int64(24 * time.Hour / args.LatencyDuration)
+	combined := hdrhistogram.New(0, dayInTimeUnits, 3)
+
+	for i, stage := range args.Plan {
+		fmt.Printf("# stage %d/%d: %s for %s\n", i+1, len(args.Plan), stage.Name, stage.Duration)
+		r := newRunner(stageArgs(args, stage, i == 0))
+		ctrl.set([]string{stage.Name}, []*runner{r})
+		r.printRequestInfo()
+		printHeader("", args.Interval)
+		wasInterrupted := r.run(interrupted, stage.Duration)
+		r.printSummary()
+		combined.Merge(r.globalHist)
+		if wasInterrupted {
+			break
+		}
+	}
+
+	fmt.Println("# combined")
+	if !args.NoLatencySummary {
+		hdrreport.PrintLatencySummary(combined)
+	}
+	return combined
+}
+
+// stageArgs returns the arguments of a stage: the command line flags
+// overridden by whatever the stage sets. Only the first stage warms up.
+func stageArgs(args *cli.Args, stage plan.Stage, first bool) *cli.Args {
+	stageArgs := *args
+	if stage.Profile != nil {
+		stageArgs.RateProfile = stage.Profile
+	}
+	if stage.Concurrency > 0 {
+		stageArgs.Concurrency = stage.Concurrency
+	}
+	if stage.Method != "" {
+		stageArgs.Method = stage.Method
+	}
+	if stage.Urls != nil {
+		stageArgs.DstUrls = stage.Urls
+		stageArgs.UrlSource = ""
+		stageArgs.Requests = nil
+		stageArgs.RequestsFile = ""
+		stageArgs.HarFile = ""
+		stageArgs.AccessLogFile = ""
+		stageArgs.SkippedLines = 0
+	}
+	if stage.Hosts != nil {
+		stageArgs.Host = stage.Hosts
+		stageArgs.HostWeights = stage.HostWeights
+	}
+	if stage.Headers != nil {
+		stageArgs.Headers = args.Headers.Clone()
+		if stageArgs.Headers == nil {
+			stageArgs.Headers = make(http.Header)
+		}
+		for name, values := range stage.Headers {
+			stageArgs.Headers[name] = values
+		}
+		stageArgs.StageHeaders = stage.Headers
+	}
+	if stage.Body != nil {
+		stageArgs.Data = stage.Body
+		stageArgs.DataSource = ""
+		stageArgs.Form = nil
+	}
+	if !first {
+		stageArgs.Warmup = 0
+		stageArgs.WarmupIterations = 0
+	}
+	return &stageArgs
+}
@@ -0,0 +1,39 @@
+package generator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// replayLag tracks how far behind their recorded times the requests of a
+// replay were sent, because request threads were busy or the client couldn't
+// keep up. Request threads record it concurrently.
+type replayLag struct {
+	mu sync.Mutex
+	// hist holds lags in microseconds.
+	hist *hdrhistogram.Histogram
+}
+
+func newReplayLag() *replayLag {
+	return &replayLag{hist: hdrhistogram.New(0, (24 * time.Hour).Microseconds(), 3)}
+}
+
+func (l *replayLag) record(lag time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hist.RecordValue(max(lag, 0).Microseconds())
+}
+
+// print prints the quantiles of the lag.
+func (l *replayLag) print() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	quantile := func(q float64) time.Duration {
+		return time.Duration(l.hist.ValueAtQuantile(q)) * time.Microsecond
+	}
+	fmt.Printf("# replay lag p50 %s, p99 %s, max %s\n",
+		quantile(50), quantile(99), time.Duration(l.hist.Max())*time.Microsecond)
+}
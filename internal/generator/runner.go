@@ -0,0 +1,743 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/auth"
+	"github.com/vspaz/slow_cooker/internal/cli"
+	"github.com/vspaz/slow_cooker/internal/hdrreport"
+	"github.com/vspaz/slow_cooker/internal/metrics"
+	"github.com/vspaz/slow_cooker/internal/pacer"
+	"github.com/vspaz/slow_cooker/internal/ring"
+	"github.com/vspaz/slow_cooker/internal/templating"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// minSearchGoalPercent is the goal% an interval must reach to meet the SLO
+// during -search, since a saturated client or server shows up as missed
+// traffic before it shows up as latency.
+const minSearchGoalPercent = 95
+
+// runner sends the traffic described by one set of arguments, prints a line
+// for every reporting interval and keeps the latency histogram of the whole
+// run.
+type runner struct {
+	args *cli.Args
+	// prefix precedes the interval lines of the runner, to tell them apart
+	// when several runners share stdout.
+	prefix string
+	// intervals, if set, receives the stats of every interval.
+	intervals chan<- intervalStats
+
+	requestGenerator *RequestGenerator
+	schedule         *pacer.Pacer
+	received         chan *MeasuredResponse
+	stop             chan struct{}
+	sendTraffic      sync.WaitGroup
+	// timeline, if set, schedules the requests in place of schedule, which
+	// then only follows its rate, and lag tracks how late they were sent.
+	timeline *pacer.Timeline
+	lag      *replayLag
+	// In open-loop mode requests are sent concurrently, so body buffers are
+	// shared through a pool instead of being owned by a goroutine.
+	bodyBuffers sync.Pool
+	// commands are run on the event loop of the runner, so that they can
+	// safely change its state while it runs.
+	commands chan func()
+	// done is closed once run returns.
+	done chan struct{}
+	// exhausted is closed once there is nothing left to send: the -feeder
+	// has no rows left or the replay is over. exhaustedBy says which.
+	exhausted     chan struct{}
+	exhaustedOnce sync.Once
+	exhaustedBy   string
+	// workers holds a channel per request thread, closed to stop it.
+	workers []chan struct{}
+	stride  int
+	shuffle shuffler
+
+	pauseMu sync.Mutex
+	// resumed is closed when a paused runner resumes, nil while running.
+	resumed          chan struct{}
+	pausedInInterval bool
+
+	latencyDurNS int64
+	reqID        uint64
+	start        time.Time
+	end          time.Time
+	// stopped is when the runner stopped sending traffic, zero while running.
+	stopped time.Time
+	// target is the traffic intended in the current interval up to
+	// targetSince. It is brought up to date whenever the rate changes or the
+	// runner pauses, so that neither skews goal%.
+	target           float64
+	targetSince      time.Time
+	intended         float64
+	iteration        uint64
+	warmupIterations uint64
+	warmingUp        bool
+	// drained and abandoned count the requests that were in flight when the
+	// run ended, depending on whether they completed within -drainTimeout.
+	drained   uint64
+	abandoned uint64
+
+	// Response tracking metadata for the current interval.
+	count           uint64
+	size            uint64
+	good            uint64
+	bad             uint64
+	failed          uint64
+	minValue        int64
+	maxValue        int64
+	failedHashCheck int64
+	hist            *hdrhistogram.Histogram
+
+	globalHist *hdrhistogram.Histogram
+	// searchHist holds the interval histogram of the highest rate found by
+	// -search that met the SLO.
+	searchHist     *hdrhistogram.Histogram
+	latencyHistory ring.IntRing
+	// targetCounts counts the responses of the whole run per target, whose
+	// names are kept in targetNames in the order they were first seen.
+	targetCounts map[string]uint64
+	targetNames  []string
+	// hostStats holds the stats of the whole run per Host header.
+	hostStats map[string]*outcomeStats
+	flowStats flowStats
+	// sessionStats holds the stats of the setup and teardown steps of the
+	// virtual users, by step.
+	sessionStats map[string]*outcomeStats
+}
+
+func newRunner(args *cli.Args) *runner {
+	// dayInTimeUnits represents the number of time units (ms, us, or ns) in a 24-hour day.
+	dayInTimeUnits := int64(24 * time.Hour / args.LatencyDuration)
+
+	r := &runner{
+		args:             args,
+		requestGenerator: NewRequestGenerator(args),
+		received:         make(chan *MeasuredResponse),
+		stop:             make(chan struct{}),
+		commands:         make(chan func()),
+		done:             make(chan struct{}),
+		exhausted:        make(chan struct{}),
+		bodyBuffers: sync.Pool{
+			New: func() any {
+				return make([]byte, 50000)
+			},
+		},
+		latencyDurNS:   args.LatencyDuration.Nanoseconds(),
+		warmingUp:      args.Warmup > 0 || args.WarmupIterations > 0,
+		minValue:       math.MaxInt64,
+		hist:           hdrhistogram.New(0, dayInTimeUnits, 3),
+		globalHist:     hdrhistogram.New(0, dayInTimeUnits, 3),
+		searchHist:     hdrhistogram.New(0, dayInTimeUnits, 3),
+		latencyHistory: ring.New(5),
+		targetCounts:   make(map[string]uint64),
+		hostStats:      make(map[string]*outcomeStats),
+		sessionStats:   make(map[string]*outcomeStats),
+		flowStats: flowStats{
+			hist:  hdrhistogram.New(0, dayInTimeUnits, 3),
+			steps: make(map[string]*outcomeStats),
+		},
+	}
+	r.shuffle.count = r.requestGenerator.TargetCount
+	return r
+}
+
+// printRequestInfo prints what the runner is about to send.
+func (r *runner) printRequestInfo() {
+	println(r.prefix + GetRequestInfo(r.args))
+	if _, ok := r.args.Arrival.(pacer.Uniform); !ok {
+		fmt.Printf("%s# %s arrivals with seed=%d\n", r.prefix, r.args.Arrival, r.args.Seed)
+	}
+	if r.args.Feeder != nil {
+		fmt.Printf("%s# feeding rows of %s\n", r.prefix, r.args.Feeder)
+	}
+	if r.args.Form != nil {
+		fmt.Printf("%s# sending %s\n", r.prefix, r.args.Form)
+	}
+	if r.args.Auth != nil {
+		fmt.Printf("%s# authenticating with %s\n", r.prefix, r.args.Auth)
+	}
+	if r.args.Signer != nil {
+		fmt.Printf("%s# signing with %s\n", r.prefix, r.args.Signer)
+	}
+	if r.args.Cookies {
+		fmt.Printf("%s# %d virtual users with their own cookie jars\n", r.prefix, r.args.Concurrency)
+	}
+}
+
+// run sends traffic until the run is over, either because its duration (if
+// non-zero) has passed, it reached -iterations or -totalRequests, the search
+// is done, there is nothing left to send or a signal was received. It
+// reports whether it was interrupted or ran out of requests, which ends a
+// plan too.
+func (r *runner) run(interrupted <-chan os.Signal, duration time.Duration) bool {
+	defer close(r.done)
+	r.start = time.Now()
+	r.targetSince = r.start
+	profile := r.args.RateProfile
+	if r.args.Timeline != nil {
+		r.timeline = pacer.NewTimeline(r.args.Timeline, r.start)
+		r.lag = newReplayLag()
+		profile = r.timeline
+	}
+	r.schedule = pacer.New(profile, r.args.Arrival, r.start, !r.args.OpenLoop)
+	r.stride = r.args.Concurrency
+	if r.stride > len(r.args.DstUrls) {
+		r.stride = 1
+	}
+	r.setConcurrency(r.args.Concurrency)
+
+	if duration > 0 {
+		r.end = r.start.Add(duration)
+	}
+	timeout := time.After(r.untilNextReport())
+	for {
+		select {
+		// If we get a SIGINT or SIGTERM, then start the shutdown process.
+		case <-interrupted:
+			r.finish()
+			return true
+		case <-r.exhausted:
+			r.finish()
+			// Report what was sent since the last interval line.
+			r.reportInterval(r.stopped)
+			fmt.Printf("%s# %s\n", r.prefix, r.exhaustedBy)
+			return true
+		case t := <-timeout:
+			done := r.reportInterval(t)
+			if done || (!r.end.IsZero() && !t.Before(r.end)) {
+				r.finish()
+				return false
+			}
+			timeout = time.After(r.untilNextReport())
+		case managedResp := <-r.received:
+			r.record(managedResp)
+		case command := <-r.commands:
+			command()
+		}
+	}
+}
+
+// do runs f on the event loop of the runner and reports false if the run is
+// already over.
+func (r *runner) do(f func()) bool {
+	ran := make(chan struct{})
+	select {
+	case r.commands <- func() {
+		f()
+		close(ran)
+	}:
+		<-ran
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// untilNextReport returns how long to wait for the next interval line. The
+// last interval of a run with a duration is cut short to end with the run.
+func (r *runner) untilNextReport() time.Duration {
+	wait := r.args.Interval
+	if !r.end.IsZero() {
+		if remaining := time.Until(r.end); remaining < wait {
+			wait = remaining
+		}
+	}
+	return wait
+}
+
+// setConcurrency starts or stops request threads until n of them are
+// running.
+func (r *runner) setConcurrency(n int) {
+	for len(r.workers) < n {
+		quit := make(chan struct{})
+		workerID := len(r.workers)
+		r.workers = append(r.workers, quit)
+		r.sendTraffic.Add(1)
+		go r.sendRequests(workerID, quit)
+	}
+	for len(r.workers) > n {
+		close(r.workers[len(r.workers)-1])
+		r.workers = r.workers[:len(r.workers)-1]
+	}
+	r.args.Concurrency = n
+}
+
+// sendRequests sends requests on schedule until the run is over or quit is
+// closed.
+func (r *runner) sendRequests(workerID int, quit <-chan struct{}) {
+	defer r.sendTraffic.Done()
+	pick := r.newPicker(workerID)
+	// For each goroutine we want to reuse a buffer for performance reasons.
+	bodyBuffer := make([]byte, 50000)
+	user, ok := r.newUser(workerID)
+	if !ok {
+		r.exhaust("feeder exhausted")
+		return
+	}
+	var client *http.Client
+	if user != nil {
+		client = user.client
+		defer r.teardownUser(user, bodyBuffer)
+		if !user.ready && r.waitWhilePaused(quit) {
+			r.setupUser(user, bodyBuffer)
+		}
+	}
+	for {
+		if !r.waitWhilePaused(quit) {
+			return
+		}
+		offset := -1
+		var scheduledAt time.Time
+		due := true
+		if r.timeline != nil {
+			var ok bool
+			if offset, scheduledAt, ok = r.timeline.Next(); !ok {
+				r.exhaust("replay done")
+				return
+			}
+		} else {
+			scheduledAt, due = r.schedule.Next(time.Now())
+		}
+		if !r.sleepUntil(scheduledAt, quit) {
+			return
+		}
+		if !due {
+			// No request was due yet, e.g. at a rate of zero.
+			continue
+		}
+		if r.paused() {
+			// The runner was paused while we were waiting to send.
+			continue
+		}
+		if r.timeline != nil {
+			r.lag.record(time.Since(scheduledAt))
+		}
+		if user != nil && !user.ready {
+			// A failed setup is retried in place of the next request.
+			r.setupUser(user, bodyBuffer)
+			continue
+		}
+		checkHash := false
+		hasher := fnv.New64a()
+		if r.args.HashSampleRate > 0.0 {
+			checkHash = ShouldCheckHash(r.args.HashSampleRate)
+		}
+
+		var row map[string]string
+		if r.args.Feeder != nil {
+			var ok bool
+			if row, ok = r.args.Feeder.Next(); !ok {
+				r.exhaust("feeder exhausted")
+				return
+			}
+		}
+		if offset < 0 {
+			offset = pick()
+		}
+		vars := templating.Vars{
+			RequestID: atomic.AddUint64(&r.reqID, 1),
+			WorkerID:  workerID,
+			Iteration: atomic.LoadUint64(&r.iteration),
+			Row:       row,
+		}
+		if user != nil {
+			vars.Values = user.values
+		}
+		if r.args.OpenLoop {
+			// Never wait for the previous response: a slow backend
+			// must not push back on the arrival rate.
+			r.sendTraffic.Add(1)
+			go func(offset int, scheduledAt time.Time) {
+				defer r.sendTraffic.Done()
+				buffer := r.bodyBuffers.Get().([]byte)
+				defer r.bodyBuffers.Put(buffer)
+				if r.args.Flow != nil {
+					r.sendFlow(client, vars, buffer, scheduledAt)
+					return
+				}
+				r.requestGenerator.DoRequest(offset, client, vars, checkHash, hasher, r.received, buffer, scheduledAt)
+			}(offset, scheduledAt)
+		} else if r.args.Flow != nil {
+			r.sendFlow(client, vars, bodyBuffer, time.Time{})
+		} else {
+			r.requestGenerator.DoRequest(
+				offset,
+				client,
+				vars,
+				checkHash,
+				hasher,
+				r.received,
+				bodyBuffer,
+				time.Time{},
+			)
+		}
+	}
+}
+
+// exhaust ends the run because there is nothing left to send, as described
+// by what.
+func (r *runner) exhaust(what string) {
+	r.exhaustedOnce.Do(func() {
+		r.exhaustedBy = what
+		close(r.exhausted)
+	})
+}
+
+// sleepUntil waits until t and reports false if the run or the request
+// thread was stopped first.
+func (r *runner) sleepUntil(t time.Time, quit <-chan struct{}) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		// A request that is already due must not be sent if the run was
+		// stopped in the meantime.
+		select {
+		case <-r.stop:
+			return false
+		case <-quit:
+			return false
+		default:
+			return true
+		}
+	case <-r.stop:
+		return false
+	case <-quit:
+		return false
+	}
+}
+
+func (r *runner) paused() bool {
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+	return r.resumed != nil
+}
+
+// waitWhilePaused waits until the runner isn't paused and reports false if
+// the run or the request thread was stopped first.
+func (r *runner) waitWhilePaused(quit <-chan struct{}) bool {
+	r.pauseMu.Lock()
+	resumed := r.resumed
+	r.pauseMu.Unlock()
+	if resumed == nil {
+		return true
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-r.stop:
+		return false
+	case <-quit:
+		return false
+	}
+}
+
+// pause stops sending traffic until resume is called. Like the other methods
+// that change the state of the runner, it must be called from its event loop.
+func (r *runner) pause() error {
+	if r.paused() {
+		return errors.New("already paused")
+	}
+	r.updateTarget(time.Now())
+	r.pauseMu.Lock()
+	r.resumed = make(chan struct{})
+	r.pauseMu.Unlock()
+	r.pausedInInterval = true
+	return nil
+}
+
+// resume resumes sending traffic at the current rate, without catching up
+// on the requests that weren't sent while paused.
+func (r *runner) resume() error {
+	if !r.paused() {
+		return errors.New("not paused")
+	}
+	now := time.Now()
+	r.schedule.Skip(now)
+	if r.timeline != nil {
+		r.timeline.Skip(now)
+	}
+	// Nothing was intended while paused.
+	r.targetSince = now
+	r.pauseMu.Lock()
+	close(r.resumed)
+	r.resumed = nil
+	r.pauseMu.Unlock()
+	return nil
+}
+
+// setRate sends traffic at a constant rate from now on.
+func (r *runner) setRate(rate float64) {
+	r.updateTarget(time.Now())
+	r.schedule.SetProfile(pacer.Constant(rate))
+}
+
+// updateTarget adds the traffic intended since targetSince to the target of
+// the current interval.
+func (r *runner) updateTarget(now time.Time) {
+	if !r.paused() {
+		r.target += pacer.Requests(r.schedule.Profile(), r.targetSince.Sub(r.start), now.Sub(r.start))
+	}
+	r.targetSince = now
+}
+
+// finish stops sending traffic and records the responses to the requests in
+// flight, abandoning those still pending after -drainTimeout.
+func (r *runner) finish() {
+	close(r.stop)
+	r.stopped = time.Now()
+	stopped := make(chan struct{})
+	go func() {
+		r.sendTraffic.Wait()
+		close(stopped)
+	}()
+	deadline := time.NewTimer(r.args.DrainTimeout)
+	defer deadline.Stop()
+	abandoning := false
+	for {
+		select {
+		case managedResp := <-r.received:
+			if managedResp.Session {
+				// Virtual users tear down as they stop.
+				r.record(managedResp)
+				continue
+			}
+			// Every request sends exactly one response, cancelled
+			// or not.
+			if abandoning {
+				r.abandoned++
+			} else {
+				r.drained++
+				r.record(managedResp)
+			}
+		case <-deadline.C:
+			abandoning = true
+			r.requestGenerator.CancelRequests()
+		case <-stopped:
+			r.requestGenerator.CancelRequests()
+			r.requestGenerator.httpClient.CloseIdleConnections()
+			return
+		}
+	}
+}
+
+// reportInterval prints the stats of the interval ending at t, resets them and
+// reports whether the run is done.
+func (r *runner) reportInterval(t time.Time) bool {
+	done := false
+	// When all requests are failures, ensure we don't accidentally
+	// print out a monstrously huge number.
+	if r.minValue == math.MaxInt64 {
+		r.minValue = 0
+	}
+	// Periodically print stats about the request load.
+	r.updateTarget(t)
+	stats := intervalStats{
+		time:            t,
+		iteration:       r.iteration,
+		good:            r.good,
+		bad:             r.bad,
+		failed:          r.failed,
+		target:          r.target,
+		rate:            r.schedule.Profile().Rate(t.Sub(r.start)),
+		minValue:        r.minValue,
+		maxValue:        r.maxValue,
+		failedHashCheck: r.failedHashCheck,
+		hist:            r.hist,
+		warmup:          r.warmingUp,
+		paused:          r.pausedInInterval,
+	}
+	r.pausedInInterval = r.paused()
+	r.intended += r.target
+	r.target = 0
+	stats.print(r.prefix, r.args.Interval, &r.latencyHistory)
+	if r.intervals != nil {
+		// The histogram is reset below, so others get their own copy.
+		stats.hist = hdrhistogram.Import(r.hist.Export())
+		r.intervals <- stats
+	}
+
+	// Request threads read the iteration for templates.
+	atomic.AddUint64(&r.iteration, 1)
+	if r.warmingUp {
+		r.warmupIterations++
+		// Warmup ends on an interval boundary so that every interval
+		// is either entirely warmup or entirely measured.
+		if r.warmupIterations >= r.args.WarmupIterations && t.Sub(r.start) >= r.args.Warmup {
+			r.warmingUp = false
+		}
+	} else if r.args.Search != nil && !stats.paused {
+		metSlo := r.good+r.bad+r.failed > 0 &&
+			r.hist.ValueAtQuantile(99) <= r.args.SloP99 &&
+			float64(r.bad+r.failed)/float64(r.good+r.bad+r.failed) <= r.args.SloErrorRate &&
+			stats.percentAchieved() >= minSearchGoalPercent
+		rate := r.args.Search.Rate()
+		if r.args.Search.Next(metSlo) {
+			done = true
+		}
+		if metSlo && r.args.Search.Best() == rate {
+			r.searchHist = hdrhistogram.Import(r.hist.Export())
+		}
+		r.setRate(r.args.Search.Rate())
+	}
+
+	if r.args.IterationCount > 0 && r.iteration-r.warmupIterations >= r.args.IterationCount {
+		done = true
+	}
+	r.count = 0
+	r.size = 0
+	r.good = 0
+	r.bad = 0
+	r.minValue = math.MaxInt64
+	r.maxValue = 0
+	r.failed = 0
+	r.failedHashCheck = 0
+	r.hist.Reset()
+
+	if r.args.TotalRequests != 0 && atomic.LoadUint64(&r.reqID) > r.args.TotalRequests {
+		done = true
+	}
+	return done
+}
+
+func (r *runner) record(managedResp *MeasuredResponse) {
+	if managedResp.Session {
+		r.recordSession(managedResp)
+		return
+	}
+	if errors.Is(managedResp.Err, auth.ErrNoToken) {
+		// The request wasn't sent; it is reported with the token stats.
+		return
+	}
+	r.count++
+	if !r.warmingUp {
+		metrics.PromRequests.Inc()
+		if _, ok := r.targetCounts[managedResp.Target]; !ok {
+			r.targetNames = append(r.targetNames, managedResp.Target)
+		}
+		r.targetCounts[managedResp.Target]++
+	}
+	if managedResp.Err != nil {
+		fmt.Fprintln(os.Stderr, managedResp.Err)
+		r.failed++
+		if !r.warmingUp {
+			r.recordHost(managedResp, 0)
+			r.recordFlow(managedResp, 0)
+		}
+		return
+	}
+
+	respLatencyNS := managedResp.Latency.Nanoseconds()
+
+	r.size += managedResp.Sz
+	if managedResp.FailedHashCheck {
+		r.failedHashCheck++
+	}
+	if managedResp.Good {
+		r.good++
+		if !r.warmingUp {
+			metrics.UpdateLatencyMetrics(respLatencyNS)
+		}
+	} else {
+		r.bad++
+	}
+
+	latency := respLatencyNS / r.latencyDurNS
+
+	if latency < r.minValue {
+		r.minValue = latency
+	}
+
+	if latency > r.maxValue {
+		r.maxValue = latency
+	}
+
+	r.hist.RecordValue(latency)
+	if !r.warmingUp {
+		r.globalHist.RecordValue(latency)
+		r.recordHost(managedResp, latency)
+		r.recordFlow(managedResp, latency)
+	}
+}
+
+// printSummary prints the realized rate, the outcome of -search and the
+// latency summary of the whole run.
+func (r *runner) printSummary() {
+	// Draining requests in flight doesn't count towards the rates.
+	now := r.stopped
+	if now.IsZero() {
+		now = time.Now()
+	}
+	r.updateTarget(now)
+	elapsed := now.Sub(r.start)
+	fmt.Printf("# realized rate %.2f req/s, intended %.2f req/s\n",
+		float64(atomic.LoadUint64(&r.reqID))/elapsed.Seconds(),
+		(r.intended+r.target)/elapsed.Seconds())
+	if r.abandoned > 0 {
+		fmt.Printf("# drained %d requests in flight, abandoned %d after %s\n", r.drained, r.abandoned, r.args.DrainTimeout)
+	} else if r.drained > 0 {
+		fmt.Printf("# drained %d requests in flight\n", r.drained)
+	}
+	if r.lag != nil {
+		r.lag.print()
+	}
+	if r.args.Flow != nil {
+		r.printFlowStats()
+	} else if len(r.targetNames) > 1 {
+		r.printTargetCounts()
+	}
+	if len(r.hostStats) > 0 {
+		r.printHostStats()
+	}
+	if len(r.sessionStats) > 0 {
+		r.printSessionStats()
+	}
+	if r.args.Search != nil {
+		if best := r.args.Search.Best(); best > 0 {
+			fmt.Printf("# highest rate meeting the SLO: %s req/s\n", formatRate(best))
+			hdrreport.PrintLatencySummary(r.searchHist)
+		} else {
+			fmt.Println("# no rate met the SLO")
+		}
+	}
+	if !r.args.NoLatencySummary {
+		hdrreport.PrintLatencySummary(r.globalHist)
+	}
+}
+
+// printTargetCounts prints how many requests were sent to each target, and
+// their share of the total, busiest first.
+func (r *runner) printTargetCounts() {
+	total := uint64(0)
+	for _, count := range r.targetCounts {
+		total += count
+	}
+	names := append([]string(nil), r.targetNames...)
+	sort.SliceStable(names, func(i, j int) bool {
+		return r.targetCounts[names[i]] > r.targetCounts[names[j]]
+	})
+	fmt.Println("# requests per target")
+	for _, name := range names {
+		count := r.targetCounts[name]
+		fmt.Printf("# %8d %5.1f%% %s\n", count, 100*float64(count)/float64(total), name)
+	}
+}
+
+// formatRate formats a rate in req/s with at most one decimal.
+func formatRate(rate float64) string {
+	return strconv.FormatFloat(math.Round(rate*10)/10, 'f', -1, 64)
+}
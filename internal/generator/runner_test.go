@@ -0,0 +1,252 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vspaz/slow_cooker/internal/auth"
+	"github.com/vspaz/slow_cooker/internal/cli"
+	"github.com/vspaz/slow_cooker/internal/feeder"
+	"github.com/vspaz/slow_cooker/internal/flow"
+	"github.com/vspaz/slow_cooker/internal/metrics"
+	"github.com/vspaz/slow_cooker/internal/pacer"
+	"github.com/vspaz/slow_cooker/internal/reqspec"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func newTestArgs(url string) *cli.Args {
+	return &cli.Args{
+		Concurrency:     2,
+		Host:            []string{""},
+		Method:          "GET",
+		Interval:        time.Hour,
+		ClientTimeout:   10 * time.Second,
+		DrainTimeout:    5 * time.Second,
+		LatencyDuration: time.Millisecond,
+		RateProfile:     pacer.Constant(100),
+		Arrival:         pacer.Uniform{},
+		DstUrls:         []string{url},
+	}
+}
+
+// interruptWhenInFlight interrupts the runner once two requests are in
+// flight.
+func interruptWhenInFlight(t *testing.T, inFlight <-chan struct{}) <-chan os.Signal {
+	interrupted := make(chan os.Signal, 1)
+	go func() {
+		for i := 0; i < 2; i++ {
+			select {
+			case <-inFlight:
+			case <-time.After(5 * time.Second):
+				t.Error("requests weren't sent")
+			}
+		}
+		interrupted <- syscall.SIGINT
+	}()
+	return interrupted
+}
+
+func TestFinishRecordsRequestsInFlight(t *testing.T) {
+	inFlight := make(chan struct{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		inFlight <- struct{}{}
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	r := newRunner(newTestArgs(server.URL))
+	require.True(t, r.run(interruptWhenInFlight(t, inFlight), 0))
+	assert.Equal(t, uint64(2), r.drained)
+	assert.Equal(t, uint64(0), r.abandoned)
+	assert.Equal(t, int64(2), r.globalHist.TotalCount())
+}
+
+func TestFinishAbandonsRequestsAfterDrainTimeout(t *testing.T) {
+	inFlight := make(chan struct{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		inFlight <- struct{}{}
+		<-req.Context().Done()
+	}))
+	defer server.Close()
+
+	args := newTestArgs(server.URL)
+	args.DrainTimeout = 50 * time.Millisecond
+	r := newRunner(args)
+	start := time.Now()
+	require.True(t, r.run(interruptWhenInFlight(t, inFlight), 0))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, uint64(0), r.drained)
+	assert.Equal(t, uint64(2), r.abandoned)
+	assert.Equal(t, int64(0), r.globalHist.TotalCount())
+}
+
+func TestRunEndsWhenFeederIsExhausted(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, req.URL.Path)
+	}))
+	defer server.Close()
+
+	args := newTestArgs(server.URL + "/users/{{.Row.user_id}}")
+	args.Templates = true
+	args.Feeder, _ = feeder.Parse("users.csv", strings.NewReader("user_id\n1\n2\n3\n"), feeder.Unique, false)
+	r := newRunner(args)
+	require.True(t, r.run(make(chan os.Signal), 0))
+	assert.ElementsMatch(t, []string{"/users/1", "/users/2", "/users/3"}, paths)
+	assert.Equal(t, int64(3), r.globalHist.TotalCount())
+}
+
+func TestRunReplaysRecordedTiming(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, req.URL.Path)
+	}))
+	defer server.Close()
+
+	args := newTestArgs(server.URL)
+	args.Concurrency = 1
+	args.Requests = []reqspec.Request{
+		{Method: "GET", URL: server.URL + "/a", Weight: 1},
+		{Method: "GET", URL: server.URL + "/b", Weight: 1},
+		{Method: "GET", URL: server.URL + "/c", Weight: 1},
+	}
+	args.DstUrls = []string{server.URL + "/a", server.URL + "/b", server.URL + "/c"}
+	args.Timeline = []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond}
+	r := newRunner(args)
+	start := time.Now()
+	require.True(t, r.run(make(chan os.Signal), 0))
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	assert.Equal(t, []string{"/a", "/b", "/c"}, paths)
+	assert.Equal(t, 3.0, r.intended+r.target)
+	assert.Equal(t, int64(3), r.lag.hist.TotalCount())
+}
+
+func TestRunSendsFlowStepsWithExtractedValues(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests = append(requests, req.Method+" "+req.URL.Path+" "+req.Header.Get("Authorization"))
+		mu.Unlock()
+		switch req.URL.Path {
+		case "/login":
+			w.Write([]byte(`{"token": "t1", "items": [{"id": 7}]}`))
+		case "/items/7":
+			if req.Header.Get("Authorization") != "Bearer t1" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer server.Close()
+
+	token, err := flow.NewExtraction("token", "json", "$.token")
+	require.NoError(t, err)
+	id, err := flow.NewExtraction("id", "json", "$.items[0].id")
+	require.NoError(t, err)
+	args := newTestArgs(server.URL + "/login")
+	args.Concurrency = 1
+	args.TotalRequests = 2
+	args.Templates = true
+	args.Flow = []flow.Step{
+		{Name: "login", Method: "POST", URL: server.URL + "/login", Extract: []flow.Extraction{token, id}},
+		{Name: "fetch", URL: server.URL + "/items/{{.Values.id}}", Headers: map[string]string{"Authorization": "Bearer {{.Values.token}}"}, ExpectStatus: 200},
+	}
+	args.DstUrls = []string{args.Flow[0].URL, args.Flow[1].URL}
+	args.Interval = 50 * time.Millisecond
+	r := newRunner(args)
+	require.False(t, r.run(make(chan os.Signal), 0))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"POST /login ", "GET /items/7 Bearer t1"}, requests[:2])
+	assert.Equal(t, uint64(0), r.flowStats.aborted)
+	assert.GreaterOrEqual(t, r.flowStats.completed, uint64(1))
+	assert.Equal(t, r.flowStats.completed, r.flowStats.steps["fetch"].good)
+	assert.Equal(t, int64(r.flowStats.completed), r.flowStats.hist.TotalCount())
+}
+
+func TestRecordFlowCountsAbortedFlows(t *testing.T) {
+	args := newTestArgs("http://a.test/login")
+	args.Flow = []flow.Step{{Name: "login", URL: "http://a.test/login"}, {Name: "fetch", URL: "http://a.test/items"}}
+	r := newRunner(args)
+	r.record(&MeasuredResponse{Target: "login", Code: 200, Good: true, Latency: 5 * time.Millisecond})
+	r.record(&MeasuredResponse{Target: "fetch", Code: 200, Good: true, Latency: 9 * time.Millisecond, FlowDuration: 14 * time.Millisecond})
+	r.record(&MeasuredResponse{Target: "login", Code: 401, FlowAborted: true})
+
+	assert.Equal(t, uint64(1), r.flowStats.steps["login"].good)
+	assert.Equal(t, uint64(1), r.flowStats.steps["login"].bad)
+	assert.Equal(t, uint64(1), r.flowStats.completed)
+	assert.Equal(t, uint64(1), r.flowStats.aborted)
+	assert.Equal(t, int64(14), r.flowStats.hist.Max())
+}
+
+func TestRecordSkipsRequestsWithoutToken(t *testing.T) {
+	r := newRunner(newTestArgs("http://a.test/"))
+	r.record(&MeasuredResponse{Target: "GET http://a.test/", Err: fmt.Errorf("%w: token endpoint returned 503 Service Unavailable", auth.ErrNoToken)})
+	r.record(&MeasuredResponse{Target: "GET http://a.test/", Err: errors.New("connection refused")})
+
+	// Only the request that was sent counts as failed.
+	assert.Equal(t, uint64(1), r.count)
+	assert.Equal(t, uint64(1), r.failed)
+	assert.Equal(t, uint64(1), r.targetCounts["GET http://a.test/"])
+}
+
+func TestWarmupIsExcludedFromSummary(t *testing.T) {
+	args := newTestArgs("http://a.test/")
+	args.WarmupIterations = 2
+	args.IterationCount = 1
+	r := newRunner(args)
+	intervals := make(chan intervalStats, 1)
+	r.intervals = intervals
+	r.start = time.Now()
+	r.targetSince = r.start
+	r.schedule = pacer.New(args.RateProfile, args.Arrival, r.start, true)
+	requests := testutil.ToFloat64(metrics.PromRequests)
+
+	// Two warmup intervals, then the single one of -iterations.
+	for i := 0; i < 3; i++ {
+		r.record(&MeasuredResponse{Target: "GET http://a.test/", Code: 200, Good: true, Latency: time.Duration(i+1) * time.Millisecond})
+		done := r.reportInterval(r.start.Add(time.Duration(i+1) * args.Interval))
+		assert.Equal(t, i == 2, done)
+		stats := <-intervals
+		assert.Equal(t, i < 2, stats.warmup)
+		assert.Equal(t, int64(1), stats.hist.TotalCount())
+	}
+	// The CSV report is written from the global histogram.
+	assert.Equal(t, int64(1), r.globalHist.TotalCount())
+	assert.Equal(t, int64(3), r.globalHist.Max())
+	assert.Equal(t, uint64(1), r.targetCounts["GET http://a.test/"])
+	assert.Equal(t, requests+1, testutil.ToFloat64(metrics.PromRequests))
+}
+
+func TestTotalRequestsCountsWarmup(t *testing.T) {
+	args := newTestArgs("http://a.test/")
+	args.WarmupIterations = 3
+	args.TotalRequests = 5
+	r := newRunner(args)
+	r.start = time.Now()
+	r.targetSince = r.start
+	r.schedule = pacer.New(args.RateProfile, args.Arrival, r.start, true)
+
+	r.reqID = 5
+	assert.False(t, r.reportInterval(r.start.Add(args.Interval)))
+	// Requests sent during warmup count toward -totalRequests.
+	r.reqID = 6
+	assert.True(t, r.reportInterval(r.start.Add(2*args.Interval)))
+	assert.True(t, r.warmingUp)
+}
@@ -0,0 +1,162 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/cli"
+	"github.com/vspaz/slow_cooker/internal/hdrreport"
+	"github.com/vspaz/slow_cooker/internal/ring"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// aggregateName labels the interval lines and summary of all scenarios.
+const aggregateName = "total"
+
+// runScenarios runs all scenarios at the same time. Every interval, each
+// scenario prints its own line, prefixed with its name, followed by a line
+// aggregating all of them, or those still running once some ended. At the end each scenario prints its summary,
+// followed by the aggregate one, whose latency histogram is returned.
+func runScenarios(args *cli.Args, interrupted <-chan os.Signal, ctrl *controller) *hdrhistogram.Histogram {
+	width := len(aggregateName)
+	for _, scenario := range args.Scenarios {
+		width = max(width, len(scenario.Name))
+	}
+	prefix := func(name string) string {
+		return fmt.Sprintf("%-*s ", width, name)
+	}
+
+	intervals := make(chan intervalStats)
+	runners := make([]*runner, len(args.Scenarios))
+	for i, scenario := range args.Scenarios {
+		scenarioArgs := stageArgs(args, scenario, true)
+		// Scenarios are paced at the same time, each drawing from its own
+		// generator.
+		scenarioArgs.Seed = args.Seed + int64(i)
+		scenarioArgs.Arrival = args.Arrival.Clone(scenarioArgs.Seed)
+		runners[i] = newRunner(scenarioArgs)
+		runners[i].prefix = prefix(scenario.Name)
+		runners[i].intervals = intervals
+		runners[i].printRequestInfo()
+	}
+	printHeader(prefix("scenario"), args.Interval)
+
+	names := make([]string, len(args.Scenarios))
+	for i, scenario := range args.Scenarios {
+		names[i] = scenario.Name
+	}
+	ctrl.set(names, runners)
+
+	// Each runner gets its own copy of the signals we receive.
+	signals := make([]chan os.Signal, len(runners))
+	// ended receives the number of intervals each runner reported once it
+	// returns.
+	ended := make(chan uint64)
+	for i, r := range runners {
+		signals[i] = make(chan os.Signal, 1)
+		go func(r *runner, signals <-chan os.Signal) {
+			r.run(signals, 0)
+			ended <- atomic.LoadUint64(&r.iteration)
+		}(r, signals[i])
+	}
+
+	aggregates := newAggregator(len(runners))
+	latencyHistory := ring.New(5)
+	for aggregates.running > 0 {
+		var complete []*intervalStats
+		select {
+		case sig := <-interrupted:
+			for _, runnerSignals := range signals {
+				select {
+				case runnerSignals <- sig:
+				default:
+				}
+			}
+		case stats := <-intervals:
+			complete = aggregates.add(stats)
+		case iterations := <-ended:
+			complete = aggregates.end(iterations)
+		}
+		for _, aggregate := range complete {
+			aggregate.print(prefix(aggregateName), args.Interval, &latencyHistory)
+		}
+	}
+
+	dayInTimeUnits := int64(24 * time.Hour / args.LatencyDuration)
+	combined := hdrhistogram.New(0, dayInTimeUnits, 3)
+	for i, r := range runners {
+		fmt.Printf("# scenario %s\n", args.Scenarios[i].Name)
+		r.printSummary()
+		combined.Merge(r.globalHist)
+	}
+	fmt.Printf("# %s\n", aggregateName)
+	if !args.NoLatencySummary {
+		hdrreport.PrintLatencySummary(combined)
+	}
+	return combined
+}
+
+// aggregator adds up the intervals of all scenarios. The aggregate of an
+// iteration is complete once every scenario that is still running, or ended
+// after it, has reported it.
+type aggregator struct {
+	running    int
+	aggregates map[uint64]*intervalStats
+	reported   map[uint64]int
+	// ended holds the number of intervals reported by each scenario that
+	// ended.
+	ended []uint64
+}
+
+func newAggregator(scenarios int) *aggregator {
+	return &aggregator{
+		running:    scenarios,
+		aggregates: make(map[uint64]*intervalStats),
+		reported:   make(map[uint64]int),
+	}
+}
+
+// add adds the stats of a scenario's interval, and returns the aggregates
+// that are complete.
+func (a *aggregator) add(stats intervalStats) []*intervalStats {
+	if aggregate, ok := a.aggregates[stats.iteration]; ok {
+		aggregate.add(&stats)
+	} else {
+		a.aggregates[stats.iteration] = &stats
+	}
+	a.reported[stats.iteration]++
+	return a.complete()
+}
+
+// end records that a scenario ended after reporting the given number of
+// intervals, and returns the aggregates that no longer wait for it.
+func (a *aggregator) end(iterations uint64) []*intervalStats {
+	a.running--
+	a.ended = append(a.ended, iterations)
+	return a.complete()
+}
+
+// complete removes and returns the complete aggregates, oldest first.
+func (a *aggregator) complete() []*intervalStats {
+	var complete []*intervalStats
+	for iteration, aggregate := range a.aggregates {
+		expected := a.running
+		for _, iterations := range a.ended {
+			if iterations > iteration {
+				expected++
+			}
+		}
+		if a.reported[iteration] >= expected {
+			complete = append(complete, aggregate)
+			delete(a.aggregates, iteration)
+			delete(a.reported, iteration)
+		}
+	}
+	sort.Slice(complete, func(i, j int) bool {
+		return complete[i].iteration < complete[j].iteration
+	})
+	return complete
+}
@@ -0,0 +1,90 @@
+package generator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vspaz/slow_cooker/internal/cli"
+	"github.com/vspaz/slow_cooker/internal/pacer"
+	"github.com/vspaz/slow_cooker/internal/plan"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+func TestRunScenariosWithRandomArrivals(t *testing.T) {
+	var mu sync.Mutex
+	paths := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths[req.URL.Path]++
+	}))
+	defer server.Close()
+
+	arrival, _ := pacer.ParseArrival("poisson", 1)
+	args := &cli.Args{
+		Concurrency:     2,
+		Host:            []string{""},
+		Method:          "GET",
+		Interval:        time.Hour,
+		ClientTimeout:   10 * time.Second,
+		LatencyDuration: time.Millisecond,
+		RateProfile:     pacer.Constant(100),
+		Arrival:         arrival,
+		Seed:            1,
+		DstUrls:         []string{server.URL},
+		Scenarios: []plan.Stage{
+			{Name: "browse", Urls: []string{server.URL + "/browse"}},
+			{Name: "buy", Urls: []string{server.URL + "/buy"}},
+		},
+	}
+	interrupted := make(chan os.Signal, 1)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		interrupted <- syscall.SIGINT
+	}()
+	runScenarios(args, interrupted, &controller{})
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Greater(t, paths["/browse"], 0)
+	assert.Greater(t, paths["/buy"], 0)
+}
+
+func TestAggregateScenariosOfDifferentLengths(t *testing.T) {
+	interval := func(iteration uint64, good uint64) intervalStats {
+		hist := hdrhistogram.New(0, 1000, 3)
+		return intervalStats{iteration: iteration, good: good, hist: hist}
+	}
+	a := newAggregator(2)
+	assert.Empty(t, a.add(interval(0, 1)))
+	complete := a.add(interval(0, 2))
+	require.Len(t, complete, 1)
+	assert.Equal(t, uint64(3), complete[0].good)
+
+	// The first scenario reports its second interval and ends, the second
+	// one reports two more.
+	assert.Empty(t, a.add(interval(1, 1)))
+	assert.Empty(t, a.end(2))
+	complete = a.add(interval(1, 2))
+	require.Len(t, complete, 1)
+	assert.Equal(t, uint64(3), complete[0].good)
+	complete = a.add(interval(2, 2))
+	require.Len(t, complete, 1)
+	assert.Equal(t, uint64(2), complete[0].good)
+
+	// The second scenario ends before the first one reported its interval.
+	a = newAggregator(2)
+	assert.Empty(t, a.add(interval(0, 1)))
+	complete = a.end(0)
+	require.Len(t, complete, 1)
+	assert.Equal(t, uint64(0), complete[0].iteration)
+	assert.Empty(t, a.end(1))
+	assert.Equal(t, 0, a.running)
+}
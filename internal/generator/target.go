@@ -0,0 +1,249 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/cli"
+	"github.com/vspaz/slow_cooker/internal/flow"
+	"github.com/vspaz/slow_cooker/internal/form"
+	"github.com/vspaz/slow_cooker/internal/templating"
+	"net/http"
+)
+
+// target is one of the requests that are sent in turn: one per URL of the
+// target url argument, per request of -requests, or per step of -flow.
+type target struct {
+	// name identifies the target in the count of requests per target.
+	name   string
+	weight float64
+	method string
+	url    string
+	header http.Header
+	body   []byte
+	// form, if set, builds the body of every request to the target, which
+	// body holds with the values of its fields.
+	form *form.Form
+	// expectStatus is the status code of a good response, any 2xx if zero.
+	expectStatus int
+	// templates is nil unless -templates is set.
+	templates *targetTemplates
+	// extract holds the values that the steps of a flow extract from the
+	// response.
+	extract []flow.Extraction
+}
+
+// targetTemplates are the templates of the URL, header values and body of a
+// target, or the values of the fields of its form, parsed once for all
+// requests.
+type targetTemplates struct {
+	url    *templating.Template
+	header map[string][]*templating.Template
+	body   *templating.Template
+	// form holds a template per field of the form, nil for files.
+	form []*templating.Template
+}
+
+// newTargets returns the targets described by args. Requests of -requests
+// and steps of -flow inherit the method, headers and body or form of the
+// flags that they don't set.
+func newTargets(args *cli.Args) []*target {
+	if args.Flow != nil {
+		return newStepTargets(args, args.Flow, args.SessionValues())
+	}
+	var targets []*target
+	if args.Requests != nil {
+		for _, request := range args.Requests {
+			t := &target{
+				weight:       request.Weight,
+				method:       request.Method,
+				url:          request.URL,
+				header:       flagHeader(args.Headers),
+				body:         request.Body,
+				expectStatus: request.ExpectStatus,
+			}
+			if t.method == "" {
+				t.method = args.Method
+			}
+			if t.body == nil {
+				t.body = args.Data
+			}
+			for name, values := range request.Header {
+				t.header[name] = values
+			}
+			if request.Body == nil && args.Form != nil {
+				t.setForm(args.Form)
+			}
+			targets = append(targets, t)
+		}
+	} else {
+		for _, url := range args.DstUrls {
+			t := &target{
+				weight: 1,
+				method: args.Method,
+				url:    url,
+				header: flagHeader(args.Headers),
+				body:   args.Data,
+			}
+			if args.Form != nil {
+				t.setForm(args.Form)
+			}
+			targets = append(targets, t)
+		}
+	}
+	for i, t := range targets {
+		t.name = t.method + " " + t.url
+		if args.Templates {
+			t.templates = newTargetTemplates(fmt.Sprintf("request %d", i+1), t, args.Feeder.Columns(), args.SessionValues())
+		}
+	}
+	return targets
+}
+
+// newStepTargets returns the targets of the steps of a flow, named after
+// them, whose templates can refer to the given values and those extracted by
+// the steps before.
+func newStepTargets(args *cli.Args, steps []flow.Step, values []string) []*target {
+	var targets []*target
+	for i, step := range steps {
+		t := &target{
+			name:         step.Name,
+			weight:       1,
+			method:       step.Method,
+			url:          step.URL,
+			header:       flagHeader(args.Headers),
+			body:         step.Body,
+			expectStatus: step.ExpectStatus,
+			extract:      step.Extract,
+		}
+		if t.method == "" {
+			t.method = args.Method
+		}
+		if t.body == nil {
+			t.body = args.Data
+		}
+		for name, value := range step.Headers {
+			t.header.Set(name, value)
+		}
+		if step.Body == nil && args.Form != nil {
+			t.setForm(args.Form)
+		}
+		stepValues := append(append([]string(nil), values...), flow.Values(steps, i)...)
+		t.templates = newTargetTemplates(step.Name, t, args.Feeder.Columns(), stepValues)
+		targets = append(targets, t)
+	}
+	return targets
+}
+
+// newSessionTargets returns the targets of the steps of -userSetup or
+// -userTeardown, named after them prefixed with kind. Unlike those of -flow,
+// they don't inherit the flags, whose templates may refer to the values of
+// the setup, and are sent with GET unless they set a method.
+func newSessionTargets(args *cli.Args, kind string, steps []flow.Step, values []string) []*target {
+	targets := newStepTargets(&cli.Args{Method: "GET", Feeder: args.Feeder}, steps, values)
+	for _, t := range targets {
+		t.name = kind + " " + t.name
+	}
+	return targets
+}
+
+// flagHeader returns a copy of the headers of -headers and -headerFile.
+func flagHeader(headers http.Header) http.Header {
+	header := make(http.Header)
+	for name, values := range headers {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+	return header
+}
+
+// setForm makes the target send the bodies of f, with their Content-Type.
+func (t *target) setForm(f *form.Form) {
+	t.form = f
+	t.body = f.Encode(nil)
+	t.header.Set("Content-Type", f.ContentType())
+}
+
+// newTargetTemplates parses templates that were already checked by cli.
+func newTargetTemplates(name string, t *target, columns []string, values []string) *targetTemplates {
+	templates := &targetTemplates{
+		url:    templating.MustParse(name, t.url, columns, values),
+		header: make(map[string][]*templating.Template),
+	}
+	if t.form == nil {
+		templates.body = templating.MustParse(name, string(t.body), columns, values)
+	} else {
+		// The content of files isn't rendered.
+		templates.form = make([]*templating.Template, len(t.form.Fields))
+		for i, field := range t.form.Fields {
+			if !field.IsFile() {
+				templates.form[i] = templating.MustParse(name, field.Value, columns, values)
+			}
+		}
+	}
+	for headerName, headerValues := range t.header {
+		for _, value := range headerValues {
+			templates.header[headerName] = append(templates.header[headerName], templating.MustParse(name, value, columns, values))
+		}
+	}
+	return templates
+}
+
+// render returns the URL, header and body of a request to the target.
+func (t *target) render(vars templating.Vars) (string, http.Header, []byte, error) {
+	if t.templates == nil {
+		return t.url, t.header, t.body, nil
+	}
+	url, err := t.templates.url.Render(vars)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	header := make(http.Header, len(t.templates.header))
+	for name, templates := range t.templates.header {
+		for _, template := range templates {
+			value, err := template.Render(vars)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			header[name] = append(header[name], value)
+		}
+	}
+	if t.form != nil {
+		fieldValues := make([]string, len(t.templates.form))
+		for i, template := range t.templates.form {
+			if template == nil {
+				continue
+			}
+			if fieldValues[i], err = template.Render(vars); err != nil {
+				return "", nil, nil, err
+			}
+		}
+		return url, header, t.form.Encode(fieldValues), nil
+	}
+	body, err := t.templates.body.Render(vars)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return url, header, []byte(body), nil
+}
+
+// isGood reports whether a response with the given status code is good.
+func (t *target) isGood(code int) bool {
+	if t.expectStatus != 0 {
+		return code == t.expectStatus
+	}
+	return code/100 == 2
+}
+
+// extractValues returns the values that a step of -flow extracts from a
+// response with the given header and body.
+func (t *target) extractValues(header http.Header, body []byte) (map[string]string, error) {
+	values := make(map[string]string, len(t.extract))
+	for _, extraction := range t.extract {
+		value, err := extraction.Extract(header, body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: extract %s: %s", t.name, extraction.Name, err)
+		}
+		values[extraction.Name] = value
+	}
+	return values, nil
+}
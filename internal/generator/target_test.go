@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vspaz/slow_cooker/internal/cli"
+	"github.com/vspaz/slow_cooker/internal/form"
+	"github.com/vspaz/slow_cooker/internal/reqspec"
+	"github.com/vspaz/slow_cooker/internal/templating"
+	"net/http"
+	"testing"
+)
+
+func TestTargetsOfUrls(t *testing.T) {
+	targets := newTargets(&cli.Args{
+		Method:  "GET",
+		Headers: http.Header{"x-test": {"yes"}},
+		Data:    []byte("body"),
+		DstUrls: []string{"http://a.test/", "http://b.test/"},
+	})
+	require.Len(t, targets, 2)
+	assert.Equal(t, &target{
+		name:   "GET http://b.test/",
+		weight: 1,
+		method: "GET",
+		url:    "http://b.test/",
+		header: http.Header{"X-Test": {"yes"}},
+		body:   []byte("body"),
+	}, targets[1])
+}
+
+func TestTargetsOfRequestsInheritFlags(t *testing.T) {
+	targets := newTargets(&cli.Args{
+		Method:  "GET",
+		Headers: http.Header{"X-Test": {"yes"}, "Accept": {"*/*"}},
+		Data:    []byte("body"),
+		Requests: []reqspec.Request{
+			{URL: "http://a.test/", Weight: 1},
+			{Method: "PUT", URL: "http://b.test/", Header: http.Header{"Accept": {"a", "b"}}, Body: []byte{}, Weight: 3, ExpectStatus: 204},
+		},
+	})
+	require.Len(t, targets, 2)
+	assert.Equal(t, &target{
+		name:   "GET http://a.test/",
+		weight: 1,
+		method: "GET",
+		url:    "http://a.test/",
+		header: http.Header{"X-Test": {"yes"}, "Accept": {"*/*"}},
+		body:   []byte("body"),
+	}, targets[0])
+	assert.Equal(t, &target{
+		name:         "PUT http://b.test/",
+		weight:       3,
+		method:       "PUT",
+		url:          "http://b.test/",
+		header:       http.Header{"X-Test": {"yes"}, "Accept": {"a", "b"}},
+		body:         []byte{},
+		expectStatus: 204,
+	}, targets[1])
+}
+
+func TestRenderTargetTemplates(t *testing.T) {
+	targets := newTargets(&cli.Args{
+		Method:    "POST",
+		Templates: true,
+		Requests: []reqspec.Request{{
+			URL:    "http://a.test/{{.WorkerID}}",
+			Header: http.Header{"X-Id": {"{{.RequestID}}", "static"}},
+			Body:   []byte("iteration {{.Iteration}}"),
+		}},
+	})
+	url, header, body, err := targets[0].render(templating.Vars{RequestID: 7, WorkerID: 2, Iteration: 3})
+	require.NoError(t, err)
+	assert.Equal(t, "http://a.test/2", url)
+	assert.Equal(t, http.Header{"X-Id": {"7", "static"}}, header)
+	assert.Equal(t, []byte("iteration 3"), body)
+}
+
+func TestRenderTargetForms(t *testing.T) {
+	f, err := form.New([]form.Field{
+		{Name: "id", Value: "{{.RequestID}}"},
+		{Name: "note", Value: "{{not a template}}", Path: "note.txt", ContentType: "text/plain", Content: []byte("{{")},
+	}, form.Multipart)
+	require.NoError(t, err)
+	targets := newTargets(&cli.Args{
+		Method:    "POST",
+		Headers:   http.Header{"Content-Type": {"text/plain"}},
+		Templates: true,
+		Form:      f,
+		DstUrls:   []string{"http://a.test/"},
+	})
+	assert.Equal(t, http.Header{"Content-Type": {f.ContentType()}}, targets[0].header)
+	_, _, body, err := targets[0].render(templating.Vars{RequestID: 7})
+	require.NoError(t, err)
+	assert.Equal(t, f.Encode([]string{"7", ""}), body)
+
+	f, err = form.New([]form.Field{{Name: "q", Value: "a b"}}, "")
+	require.NoError(t, err)
+	targets = newTargets(&cli.Args{
+		Method: "POST",
+		Form:   f,
+		Requests: []reqspec.Request{
+			{URL: "http://a.test/", Weight: 1},
+			{URL: "http://b.test/", Body: []byte("raw"), Weight: 1},
+		},
+	})
+	assert.Equal(t, []byte("q=a+b"), targets[0].body)
+	assert.Equal(t, "application/x-www-form-urlencoded", targets[0].header.Get("Content-Type"))
+	assert.Equal(t, []byte("raw"), targets[1].body)
+	assert.Nil(t, targets[1].form)
+}
+
+func TestTargetIsGood(t *testing.T) {
+	assert.True(t, (&target{}).isGood(204))
+	assert.False(t, (&target{}).isGood(500))
+	assert.True(t, (&target{expectStatus: 404}).isGood(404))
+	assert.False(t, (&target{expectStatus: 404}).isGood(200))
+}
@@ -0,0 +1,107 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/templating"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// virtualUser is the session of a request thread with -cookies: its own
+// cookie jar, the row of -feeder its setup and teardown are rendered with,
+// and the values extracted by -userSetup, which its requests can refer to.
+type virtualUser struct {
+	workerID int
+	client   *http.Client
+	row      map[string]string
+	values   map[string]string
+	// ready is set once the setup succeeded.
+	ready bool
+}
+
+// newUser returns the virtual user of a request thread, or nil without
+// -cookies. It reports false if the -feeder has no row left for it.
+func (r *runner) newUser(workerID int) (*virtualUser, bool) {
+	if !r.args.Cookies {
+		return nil, true
+	}
+	user := &virtualUser{
+		workerID: workerID,
+		client:   r.requestGenerator.newUserClient(),
+		ready:    r.requestGenerator.setup == nil,
+	}
+	if r.args.Feeder != nil && (r.requestGenerator.setup != nil || r.requestGenerator.teardown != nil) {
+		var ok bool
+		if user.row, ok = r.args.Feeder.Next(); !ok {
+			return nil, false
+		}
+	}
+	return user, true
+}
+
+// vars returns the variables of the setup and teardown steps of the user.
+func (user *virtualUser) vars(iteration uint64) templating.Vars {
+	return templating.Vars{
+		WorkerID:  user.workerID,
+		Iteration: iteration,
+		Row:       user.row,
+		Values:    user.values,
+	}
+}
+
+// setupUser sends the steps of -userSetup for a user that isn't ready, and
+// reports whether they all succeeded.
+func (r *runner) setupUser(user *virtualUser, bodyBuffer []byte) bool {
+	values, ok := r.sendSteps(r.requestGenerator.setup, user.client, user.vars(atomic.LoadUint64(&r.iteration)), bodyBuffer, time.Time{}, true)
+	if ok {
+		user.values = values
+		user.ready = true
+	}
+	return ok
+}
+
+// teardownUser sends the steps of -userTeardown for a user whose setup
+// succeeded. They are sent even once the run is stopped.
+func (r *runner) teardownUser(user *virtualUser, bodyBuffer []byte) {
+	if !user.ready || r.requestGenerator.teardown == nil {
+		return
+	}
+	r.sendSteps(r.requestGenerator.teardown, user.client, user.vars(atomic.LoadUint64(&r.iteration)), bodyBuffer, time.Time{}, true)
+}
+
+// recordSession adds a response to a setup or teardown step to the stats of
+// that step.
+func (r *runner) recordSession(managedResp *MeasuredResponse) {
+	if managedResp.Err != nil {
+		fmt.Fprintln(os.Stderr, managedResp.Err)
+	}
+	stats, ok := r.sessionStats[managedResp.Target]
+	if !ok {
+		stats = r.newOutcomeStats()
+		r.sessionStats[managedResp.Target] = stats
+	}
+	stats.record(managedResp, managedResp.Latency.Nanoseconds()/r.latencyDurNS)
+}
+
+// printSessionStats prints the outcomes and latency quantiles of the setup
+// and teardown steps of the virtual users, in order.
+func (r *runner) printSessionStats() {
+	var names []string
+	for _, t := range append(append([]*target(nil), r.requestGenerator.setup...), r.requestGenerator.teardown...) {
+		names = append(names, t.name)
+	}
+	width := len("user step")
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+	fmt.Printf("# %-*s good/b/f [p50 p95 p99  p999]\n", width, "user step")
+	for _, name := range names {
+		stats, ok := r.sessionStats[name]
+		if !ok {
+			continue
+		}
+		stats.print(width, name)
+	}
+}
@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vspaz/slow_cooker/internal/flow"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVirtualUsersKeepTheirOwnSessions(t *testing.T) {
+	var mu sync.Mutex
+	logins := 0
+	requests := make(map[string]int)
+	logouts := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req.URL.Path {
+		case "/login":
+			logins++
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.Itoa(logins)})
+			w.Write([]byte(`{"csrf": "c` + strconv.Itoa(logins) + `"}`))
+		case "/items":
+			cookie, err := req.Cookie("session")
+			if err != nil || req.Header.Get("X-Csrf") != "c"+cookie.Value {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			requests[cookie.Value]++
+		case "/logout":
+			cookie, err := req.Cookie("session")
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			logouts[cookie.Value]++
+		}
+	}))
+	defer server.Close()
+
+	csrf, err := flow.NewExtraction("csrf", "json", "$.csrf")
+	require.NoError(t, err)
+	args := newTestArgs(server.URL + "/items")
+	args.Templates = true
+	args.Cookies = true
+	args.Headers = http.Header{"X-Csrf": {"{{.Values.csrf}}"}}
+	args.UserSetup = []flow.Step{{Name: "login", URL: server.URL + "/login", Extract: []flow.Extraction{csrf}}}
+	args.UserTeardown = []flow.Step{{Name: "logout", URL: server.URL + "/logout"}}
+	args.Interval = 100 * time.Millisecond
+	args.IterationCount = 1
+	r := newRunner(args)
+	require.False(t, r.run(make(chan os.Signal), 0))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 2, logins)
+	assert.Contains(t, requests, "1")
+	assert.Contains(t, requests, "2")
+	assert.Equal(t, map[string]int{"1": 1, "2": 1}, logouts)
+	assert.Equal(t, uint64(2), r.sessionStats["setup login"].good)
+	assert.Equal(t, uint64(2), r.sessionStats["teardown logout"].good)
+}
+
+func TestVirtualUsersRetryFailedSetups(t *testing.T) {
+	var mu sync.Mutex
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.URL.Path == "/login" {
+			logins++
+			if logins == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}
+	}))
+	defer server.Close()
+
+	args := newTestArgs(server.URL + "/items")
+	args.Concurrency = 1
+	args.Cookies = true
+	args.UserSetup = []flow.Step{{Name: "login", URL: server.URL + "/login"}}
+	args.Interval = 100 * time.Millisecond
+	args.IterationCount = 1
+	r := newRunner(args)
+	require.False(t, r.run(make(chan os.Signal), 0))
+
+	assert.Equal(t, uint64(1), r.sessionStats["setup login"].bad)
+	assert.Equal(t, uint64(1), r.sessionStats["setup login"].good)
+	assert.Greater(t, r.globalHist.TotalCount(), int64(0))
+}
@@ -2,16 +2,13 @@ package generator
 
 import (
 	"fmt"
+	"github.com/vspaz/slow_cooker/internal/auth"
 	"github.com/vspaz/slow_cooker/internal/cli"
 	"math/rand"
+	"strconv"
 	"time"
 )
 
-// CalcTimeToWait calculates how many Nanoseconds to wait between actions.
-func CalcTimeToWait(qps *int) time.Duration {
-	return time.Duration(int(time.Second) / *qps)
-}
-
 // Sample Rate is between [0.0, 1.0] and determines what percentage of request bodies
 // should be checked that their hash matches a known hash.
 func ShouldCheckHash(sampleRate float64) bool {
@@ -19,12 +16,53 @@ func ShouldCheckHash(sampleRate float64) bool {
 }
 
 func GetRequestInfo(args *cli.Args) string {
+	source := args.RequestsFile
+	if args.HarFile != "" {
+		source = args.HarFile
+	} else if args.AccessLogFile != "" {
+		source = args.AccessLogFile
+	}
+	skipped := ""
+	if args.SkippedLines > 0 {
+		skipped = fmt.Sprintf("# skipped %d lines of %s without a valid request\n", args.SkippedLines, source)
+	}
+	if args.Timeline != nil {
+		speed := ""
+		if args.ReplaySpeed != 1 {
+			speed = fmt.Sprintf(" at %sx speed", strconv.FormatFloat(args.ReplaySpeed, 'f', -1, 64))
+		}
+		return fmt.Sprintf(
+			"# replaying %d requests from %s over %s%s with concurrency=%d ...\n",
+			len(args.Requests), source, args.Timeline[len(args.Timeline)-1].Round(time.Millisecond), speed, args.Concurrency) + skipped
+	}
+	if args.Flow != nil {
+		return fmt.Sprintf(
+			"# sending %s flows/s with concurrency=%d using %d steps from %s ...\n",
+			args.RateProfile, args.Concurrency, len(args.Flow), args.FlowFile)
+	}
+	if args.Requests != nil {
+		return fmt.Sprintf(
+			"# sending %s req/s with concurrency=%d using %d requests from %s ...\n",
+			args.RateProfile, args.Concurrency, len(args.Requests), source) + skipped
+	}
 	if len(args.DstUrls) == 1 {
 		return fmt.Sprintf(
-			"# sending %d %s req/s with concurrency=%d to %s ...\n",
-			(args.Qps * args.Concurrency), args.Method, args.Concurrency, args.DstUrls[0])
+			"# sending %s %s req/s with concurrency=%d to %s ...\n",
+			args.RateProfile, args.Method, args.Concurrency, args.DstUrls[0])
 	}
 	return fmt.Sprintf(
-		"# sending %d %s req/s with concurrency=%d using url list %s ...\n",
-		(args.Qps * args.Concurrency), args.Method, args.Concurrency, args.DstUrls[1:])
+		"# sending %s %s req/s with concurrency=%d using url list %s ...\n",
+		args.RateProfile, args.Method, args.Concurrency, args.DstUrls[1:])
+}
+
+// printTokenStats prints how many OAuth2 tokens were fetched, how many
+// fetches failed, how many requests weren't sent for lack of a token, and the
+// quantiles of the fetch latency.
+func printTokenStats(stats auth.TokenStats) {
+	quantile := func(q float64) time.Duration {
+		return time.Duration(stats.Latency.ValueAtQuantile(q)) * time.Microsecond
+	}
+	fmt.Printf("# token fetches %d, failed %d, requests without a token %d, latency p50 %s, p99 %s, max %s\n",
+		stats.Fetches, stats.Failures, stats.Skipped,
+		quantile(50), quantile(99), time.Duration(stats.Latency.Max())*time.Microsecond)
 }
@@ -0,0 +1,159 @@
+package har
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/reqspec"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// skippedHeaders are set by the HTTP client from the URL and body of a request
+// and aren't replayed.
+var skippedHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Connection":        true,
+	"Transfer-Encoding": true,
+}
+
+// rawArchive is the part of a HAR file that is replayed.
+type rawArchive struct {
+	Log *struct {
+		Entries []rawEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type rawEntry struct {
+	StartedDateTime string `json:"startedDateTime"`
+	Request         *struct {
+		Method  string `json:"method"`
+		URL     string `json:"url"`
+		Headers []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+		PostData *struct {
+			Text   string `json:"text"`
+			Params []struct {
+				Name  string `json:"name"`
+				Value string `json:"value"`
+			} `json:"params"`
+		} `json:"postData"`
+	} `json:"request"`
+}
+
+// Load reads the HTTP requests of the HAR file at path and returns them in
+// the order they were sent, with the time each was sent at relative to the
+// first one.
+func Load(path string) ([]reqspec.Request, []time.Duration, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	return Parse(path, file)
+}
+
+// Parse reads the HAR file of the given name from r. Entries that aren't
+// HTTP requests, e.g. WebSockets, are left out. All problems found are
+// reported together, each prefixed with the file name and entry number.
+func Parse(name string, r io.Reader) ([]reqspec.Request, []time.Duration, error) {
+	var archive rawArchive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", name, err)
+	}
+	if archive.Log == nil {
+		return nil, nil, fmt.Errorf("%s: expected a 'log' object", name)
+	}
+
+	type entry struct {
+		request reqspec.Request
+		started time.Time
+	}
+	var entries []entry
+	var errs []error
+	for i, raw := range archive.Log.Entries {
+		request, started, err := parseEntry(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: entry %d: %s", name, i+1, err))
+			continue
+		}
+		if request != nil {
+			entries = append(entries, entry{*request, started})
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("%s: the file has no HTTP requests", name)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].started.Before(entries[j].started)
+	})
+	requests := make([]reqspec.Request, len(entries))
+	offsets := make([]time.Duration, len(entries))
+	for i, entry := range entries {
+		requests[i] = entry.request
+		offsets[i] = entry.started.Sub(entries[0].started)
+	}
+	return requests, offsets, nil
+}
+
+// parseEntry returns the request of an entry and when it was sent, or a nil
+// request if it isn't an HTTP request.
+func parseEntry(raw rawEntry) (*reqspec.Request, time.Time, error) {
+	if raw.Request == nil {
+		return nil, time.Time{}, errors.New("request is required")
+	}
+	started, err := time.Parse(time.RFC3339Nano, raw.StartedDateTime)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid startedDateTime '%s'", raw.StartedDateTime)
+	}
+	URL, err := url.Parse(raw.Request.URL)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid URL '%s': %s", raw.Request.URL, err)
+	}
+	if URL.Scheme != "http" && URL.Scheme != "https" {
+		return nil, started, nil
+	}
+	if raw.Request.Method == "" {
+		return nil, time.Time{}, errors.New("method is required")
+	}
+
+	request := &reqspec.Request{
+		Method: raw.Request.Method,
+		URL:    URL.String(),
+		Header: make(http.Header),
+		// The body is never inherited from -data.
+		Body:   []byte{},
+		Weight: 1,
+	}
+	for _, header := range raw.Request.Headers {
+		// HTTP/2 pseudo-headers, e.g. :authority, start with a colon.
+		if strings.HasPrefix(header.Name, ":") || skippedHeaders[http.CanonicalHeaderKey(header.Name)] {
+			continue
+		}
+		request.Header.Add(header.Name, header.Value)
+	}
+	if postData := raw.Request.PostData; postData != nil {
+		if postData.Text == "" && len(postData.Params) > 0 {
+			form := make(url.Values)
+			for _, param := range postData.Params {
+				form.Add(param.Name, param.Value)
+			}
+			request.Body = []byte(form.Encode())
+		} else {
+			request.Body = []byte(postData.Text)
+		}
+	}
+	return request, started, nil
+}
@@ -0,0 +1,77 @@
+package har
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vspaz/slow_cooker/internal/reqspec"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const archive = `{"log": {"version": "1.2", "entries": [
+  {
+    "startedDateTime": "2024-03-01T10:00:00.250Z",
+    "request": {
+      "method": "POST", "url": "https://shop.test/cart", "httpVersion": "h2",
+      "headers": [
+        {"name": ":authority", "value": "shop.test"},
+        {"name": "content-type", "value": "application/json"},
+        {"name": "content-length", "value": "9"},
+        {"name": "cookie", "value": "session=abc"}
+      ],
+      "postData": {"mimeType": "application/json", "text": "{\"sku\":1}"}
+    }
+  },
+  {
+    "startedDateTime": "2024-03-01T10:00:00.000Z",
+    "request": {"method": "GET", "url": "https://shop.test/", "headers": [{"name": "Host", "value": "shop.test"}]}
+  },
+  {
+    "startedDateTime": "2024-03-01T10:00:01.000Z",
+    "request": {"method": "GET", "url": "wss://shop.test/live", "headers": []}
+  },
+  {
+    "startedDateTime": "2024-03-01T11:00:02.000+01:00",
+    "request": {
+      "method": "POST", "url": "https://shop.test/login", "headers": [],
+      "postData": {"mimeType": "application/x-www-form-urlencoded", "params": [{"name": "user", "value": "a b"}]}
+    }
+  }
+]}}`
+
+func TestParseArchiveOk(t *testing.T) {
+	requests, offsets, err := Parse("shop.har", strings.NewReader(archive))
+	require.NoError(t, err)
+	assert.Equal(t, []reqspec.Request{
+		{Method: "GET", URL: "https://shop.test/", Header: http.Header{}, Body: []byte{}, Weight: 1},
+		{
+			Method: "POST",
+			URL:    "https://shop.test/cart",
+			Header: http.Header{"Content-Type": {"application/json"}, "Cookie": {"session=abc"}},
+			Body:   []byte(`{"sku":1}`),
+			Weight: 1,
+		},
+		{Method: "POST", URL: "https://shop.test/login", Header: http.Header{}, Body: []byte("user=a+b"), Weight: 1},
+	}, requests)
+	assert.Equal(t, []time.Duration{0, 250 * time.Millisecond, 2 * time.Second}, offsets)
+}
+
+func TestParseArchiveErrors(t *testing.T) {
+	_, _, err := Parse("shop.har", strings.NewReader(`{"log": {"entries": [
+  {"startedDateTime": "yesterday", "request": {"method": "GET", "url": "https://shop.test/"}},
+  {"startedDateTime": "2024-03-01T10:00:00Z"},
+  {"startedDateTime": "2024-03-01T10:00:00Z", "request": {"url": "https://shop.test/"}}
+]}}`))
+	assert.EqualError(t, err, `shop.har: entry 1: invalid startedDateTime 'yesterday'
+shop.har: entry 2: request is required
+shop.har: entry 3: method is required`)
+
+	_, _, err = Parse("shop.har", strings.NewReader(`{"log": {"entries": []}}`))
+	assert.EqualError(t, err, "shop.har: the file has no HTTP requests")
+	_, _, err = Parse("shop.har", strings.NewReader(`[]`))
+	assert.EqualError(t, err, "shop.har: json: cannot unmarshal array into Go value of type har.rawArchive")
+	_, _, err = Parse("shop.har", strings.NewReader(`{}`))
+	assert.EqualError(t, err, "shop.har: expected a 'log' object")
+}
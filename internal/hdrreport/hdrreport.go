@@ -49,8 +49,9 @@ func WriteReportCSV(filename *string, hist *hdrhistogram.Histogram) error {
 	return nil
 }
 
-func PrintLatencySummary(hist *hdrhistogram.Histogram) {
-	latency := Quantiles{
+// NewQuantiles returns the quantiles of a histogram.
+func NewQuantiles(hist *hdrhistogram.Histogram) Quantiles {
+	return Quantiles{
 		Quantile50:  hist.ValueAtQuantile(50),
 		Quantile75:  hist.ValueAtQuantile(75),
 		Quantile90:  hist.ValueAtQuantile(90),
@@ -58,6 +59,10 @@ func PrintLatencySummary(hist *hdrhistogram.Histogram) {
 		Quantile99:  hist.ValueAtQuantile(99),
 		Quantile999: hist.ValueAtQuantile(999),
 	}
+}
+
+func PrintLatencySummary(hist *hdrhistogram.Histogram) {
+	latency := NewQuantiles(hist)
 
 	if data, err := json.MarshalIndent(latency, "", "  "); err != nil {
 		log.Fatal("Unable to generate report: ", err)
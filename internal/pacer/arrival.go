@@ -0,0 +1,140 @@
+package pacer
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Arrival draws the spacing between consecutive requests, expressed as a
+// multiple of the mean gap at the current rate. Draws always average to one
+// so the long-run rate still follows the Profile. An Arrival isn't safe to
+// use concurrently, outside of a Pacer.
+type Arrival interface {
+	Next() float64
+	// Clone returns the same process drawing from a generator seeded with
+	// seed, for another Pacer.
+	Clone(seed int64) Arrival
+	String() string
+}
+
+// Uniform spaces requests perfectly evenly.
+type Uniform struct{}
+
+func (Uniform) Next() float64 {
+	return 1
+}
+
+func (u Uniform) Clone(int64) Arrival {
+	return u
+}
+
+func (Uniform) String() string {
+	return "uniform"
+}
+
+// Poisson produces exponentially distributed gaps, as seen with many
+// independent clients.
+type Poisson struct {
+	rng *rand.Rand
+}
+
+func (p *Poisson) Next() float64 {
+	return p.rng.ExpFloat64()
+}
+
+func (p *Poisson) Clone(seed int64) Arrival {
+	return &Poisson{rng: newRand(seed)}
+}
+
+func (p *Poisson) String() string {
+	return "poisson"
+}
+
+// Jitter spreads gaps uniformly within Fraction of the mean gap.
+type Jitter struct {
+	Fraction float64
+	rng      *rand.Rand
+}
+
+func (j *Jitter) Next() float64 {
+	return 1 + j.Fraction*(2*j.rng.Float64()-1)
+}
+
+func (j *Jitter) Clone(seed int64) Arrival {
+	return &Jitter{Fraction: j.Fraction, rng: newRand(seed)}
+}
+
+func (j *Jitter) String() string {
+	return fmt.Sprintf("jitter:%s", formatRate(j.Fraction))
+}
+
+// Pareto produces heavy-tailed gaps: long quiet periods followed by bursts
+// of closely spaced requests. Lower Shape values are burstier.
+type Pareto struct {
+	Shape float64
+	rng   *rand.Rand
+}
+
+func (p *Pareto) Next() float64 {
+	// Scale the distribution so that its mean is one.
+	scale := (p.Shape - 1) / p.Shape
+	return scale / math.Pow(1-p.rng.Float64(), 1/p.Shape)
+}
+
+func (p *Pareto) Clone(seed int64) Arrival {
+	return &Pareto{Shape: p.Shape, rng: newRand(seed)}
+}
+
+func (p *Pareto) String() string {
+	return fmt.Sprintf("pareto:%s", formatRate(p.Shape))
+}
+
+// ParseArrival parses an arrival process specification, one of uniform,
+// poisson, jitter[:FRACTION] or pareto[:SHAPE]. Random draws come from a
+// generator seeded with seed so that runs can be reproduced.
+func ParseArrival(spec string, seed int64) (Arrival, error) {
+	kind, param, hasParam := strings.Cut(spec, ":")
+	rng := newRand(seed)
+
+	switch kind {
+	case "uniform":
+		if hasParam {
+			return nil, fmt.Errorf("invalid arrival process '%s': uniform takes no parameter", spec)
+		}
+		return Uniform{}, nil
+	case "poisson":
+		if hasParam {
+			return nil, fmt.Errorf("invalid arrival process '%s': poisson takes no parameter", spec)
+		}
+		return &Poisson{rng: rng}, nil
+	case "jitter":
+		fraction := 0.5
+		if hasParam {
+			var err error
+			fraction, err = strconv.ParseFloat(param, 64)
+			if err != nil || fraction <= 0 || fraction > 1 {
+				return nil, fmt.Errorf("invalid arrival process '%s': jitter fraction must be in the range (0.0, 1.0]", spec)
+			}
+		}
+		return &Jitter{Fraction: fraction, rng: rng}, nil
+	case "pareto":
+		shape := 1.5
+		if hasParam {
+			var err error
+			shape, err = strconv.ParseFloat(param, 64)
+			if err != nil || shape <= 1 {
+				return nil, fmt.Errorf("invalid arrival process '%s': pareto shape must be greater than 1", spec)
+			}
+		}
+		return &Pareto{Shape: shape, rng: rng}, nil
+	default:
+		return nil, fmt.Errorf("invalid arrival process '%s': expected [uniform | poisson | jitter | pareto]", spec)
+	}
+}
+
+func newRand(seed int64) *rand.Rand {
+	return rand.New(rand.NewSource(seed))
+}
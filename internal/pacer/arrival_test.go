@@ -0,0 +1,59 @@
+package pacer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseArrivalOk(t *testing.T) {
+	for spec, expected := range map[string]string{
+		"uniform":    "uniform",
+		"poisson":    "poisson",
+		"jitter":     "jitter:0.5",
+		"jitter:0.1": "jitter:0.1",
+		"pareto":     "pareto:1.5",
+		"pareto:3":   "pareto:3",
+	} {
+		arrival, err := ParseArrival(spec, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, arrival.String())
+	}
+}
+
+func TestParseArrivalErrorOk(t *testing.T) {
+	for _, spec := range []string{"poisson:2", "jitter:0", "jitter:1.5", "pareto:1", "gamma"} {
+		_, err := ParseArrival(spec, 1)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestArrivalMeanOk(t *testing.T) {
+	for _, spec := range []string{"uniform", "poisson", "jitter:0.9", "pareto:3"} {
+		arrival, _ := ParseArrival(spec, 42)
+		sum := 0.0
+		for i := 0; i < 200000; i++ {
+			sum += arrival.Next()
+		}
+		assert.InDelta(t, 1.0, sum/200000, 0.02, spec)
+	}
+}
+
+func TestArrivalSeedOk(t *testing.T) {
+	first, _ := ParseArrival("poisson", 7)
+	second, _ := ParseArrival("poisson", 7)
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, first.Next(), second.Next())
+	}
+}
+
+func TestArrivalCloneOk(t *testing.T) {
+	for _, spec := range []string{"uniform", "poisson", "jitter:0.1", "pareto:3"} {
+		arrival, _ := ParseArrival(spec, 7)
+		clone := arrival.Clone(8)
+		other, _ := ParseArrival(spec, 8)
+		assert.Equal(t, arrival.String(), clone.String())
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, other.Next(), clone.Next(), spec)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package pacer
+
+import (
+	"sync"
+	"time"
+)
+
+// maxStep bounds how far ahead the rate is extrapolated before the profile is
+// consulted again, so that very low rates don't hide a later increase. Next
+// doesn't look further than maxStep past the current time either, so that a
+// rate of zero or a new profile are consulted again soon.
+const maxStep = 100 * time.Millisecond
+
+// Pacer hands out the times at which requests should be sent so that the
+// rate follows a Profile. A single Pacer is shared by all request threads, so
+// the rate is independent of the concurrency level.
+type Pacer struct {
+	mu         sync.Mutex
+	profile    Profile
+	arrival    Arrival
+	dropMissed bool
+	start      time.Time
+	last       time.Time
+	// pending is what is left of the amount drawn from the arrival process
+	// for a request that wasn't due by the time Next looked ahead to, zero
+	// if none.
+	pending float64
+}
+
+// New returns a Pacer following the profile starting at start, spacing
+// requests according to arrival. If dropMissed is set, sends that are already
+// late when asked for are collapsed into one, like a time.Ticker does.
+func New(profile Profile, arrival Arrival, start time.Time, dropMissed bool) *Pacer {
+	return &Pacer{
+		profile:    profile,
+		arrival:    arrival,
+		dropMissed: dropMissed,
+		start:      start,
+		last:       start,
+	}
+}
+
+// Next returns the time at which the next request should be sent, and
+// whether it is due then. A request is due once the integral of the rate
+// since the previous one reaches the amount drawn from the arrival process.
+// If it isn't due within maxStep of now, e.g. because the rate is zero, Next
+// returns a time past which to call it again instead.
+func (p *Pacer) Next(now time.Time) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	need := p.pending
+	if need == 0 {
+		need = p.arrival.Next()
+	}
+	horizon := now.Add(maxStep)
+	t := p.last
+	for {
+		rate := p.profile.Rate(t.Sub(p.start))
+		if rate > 0 {
+			gap := time.Duration(need / rate * float64(time.Second))
+			if gap <= maxStep {
+				t = t.Add(gap)
+				break
+			}
+		}
+		if !t.Before(horizon) {
+			p.last = t
+			p.pending = need
+			return t, false
+		}
+		need -= rate * maxStep.Seconds()
+		t = t.Add(maxStep)
+	}
+
+	if p.dropMissed && t.Before(now) {
+		t = now
+	}
+	p.last = t
+	p.pending = 0
+	return t, true
+}
+
+// Profile returns the profile currently being followed.
+func (p *Pacer) Profile() Profile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.profile
+}
+
+// SetProfile replaces the profile followed from now on.
+func (p *Pacer) SetProfile(profile Profile) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.profile = profile
+}
+
+// Skip drops the sends that were due before now, so that traffic resumes at
+// the current rate after a pause instead of catching up.
+func (p *Pacer) Skip(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last.Before(now) {
+		p.last = now
+		p.pending = 0
+	}
+}
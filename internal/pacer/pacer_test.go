@@ -0,0 +1,125 @@
+package pacer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// nextDue returns the time of the next request due, calling Next again past
+// the times it returns that aren't due, as request threads do.
+func nextDue(p *Pacer, now time.Time) time.Time {
+	for {
+		t, due := p.Next(now)
+		if due {
+			return t
+		}
+		now = t
+	}
+}
+
+func TestConstantPacerOk(t *testing.T) {
+	start := time.Now()
+	p := New(Constant(100), Uniform{}, start, false)
+	assert.Equal(t, start.Add(10*time.Millisecond), nextDue(p, start))
+	assert.Equal(t, start.Add(20*time.Millisecond), nextDue(p, start))
+}
+
+func TestSharedPacerOk(t *testing.T) {
+	start := time.Now()
+	p := New(Constant(150), Uniform{}, start, false)
+	var wg sync.WaitGroup
+	for i := 0; i < 7; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 150; j++ {
+				nextDue(p, start)
+			}
+		}()
+	}
+	wg.Wait()
+	// 7 threads sharing a 150 req/s schedule get 1050 slots over 7 seconds.
+	assert.InDelta(t, float64(7*time.Second), float64(nextDue(p, start).Sub(start)), float64(10*time.Millisecond))
+}
+
+func TestLowRatePacerOk(t *testing.T) {
+	start := time.Now()
+	p := New(Constant(0.5), Uniform{}, start, false)
+	assert.InDelta(t, float64(2*time.Second), float64(nextDue(p, start).Sub(start)), float64(time.Millisecond))
+}
+
+func TestPacerFollowsRampOk(t *testing.T) {
+	start := time.Now()
+	// Nothing for the first second, then 1000 req/s.
+	p := New(Step{From: 0, Increment: 1000, Every: time.Second}, Uniform{}, start, false)
+	got := nextDue(p, start).Sub(start)
+	assert.InDelta(t, float64(time.Second+time.Millisecond), float64(got), float64(time.Millisecond))
+}
+
+func TestPacerDropMissedOk(t *testing.T) {
+	start := time.Now()
+	late := start.Add(time.Second)
+
+	p := New(Constant(100), Uniform{}, start, true)
+	assert.Equal(t, late, nextDue(p, late))
+	assert.Equal(t, late.Add(10*time.Millisecond), nextDue(p, late))
+
+	p = New(Constant(100), Uniform{}, start, false)
+	assert.Equal(t, start.Add(10*time.Millisecond), nextDue(p, late))
+}
+
+func TestPoissonPacerOk(t *testing.T) {
+	start := time.Now()
+	arrival, _ := ParseArrival("poisson", 1)
+	p := New(Constant(100), arrival, start, false)
+	var last time.Time
+	for i := 0; i < 10000; i++ {
+		last = nextDue(p, start)
+	}
+	// The gaps vary, but 10000 requests at 100 req/s still take about 100s.
+	assert.InDelta(t, 100.0, last.Sub(start).Seconds(), 3.0)
+}
+
+func TestSetProfileOk(t *testing.T) {
+	start := time.Now()
+	p := New(Constant(100), Uniform{}, start, false)
+	assert.Equal(t, start.Add(10*time.Millisecond), nextDue(p, start))
+	p.SetProfile(Constant(10))
+	assert.Equal(t, Constant(10), p.Profile())
+	assert.Equal(t, start.Add(110*time.Millisecond), nextDue(p, start))
+}
+
+func TestSkipOk(t *testing.T) {
+	start := time.Now()
+	p := New(Constant(100), Uniform{}, start, false)
+	p.Skip(start.Add(time.Minute))
+	assert.Equal(t, start.Add(time.Minute+10*time.Millisecond), nextDue(p, start))
+}
+
+func TestPacerRateDropsToZeroOk(t *testing.T) {
+	start := time.Now()
+	p := New(Ramp{From: 10, To: 0, Duration: time.Second}, Uniform{}, start, false)
+	now := start
+	sent := 0
+	for i := 0; i < 100; i++ {
+		next, due := p.Next(now)
+		if due {
+			sent++
+		} else {
+			assert.False(t, next.Before(now.Add(maxStep)))
+		}
+		now = next
+	}
+	// The ramp sends about 5 requests, then Next keeps returning times that
+	// aren't due instead of looking ahead forever.
+	assert.InDelta(t, 5, sent, 1)
+	assert.True(t, now.After(start.Add(9*time.Second)))
+
+	// What was left of the last request is sent once the rate picks up.
+	p.SetProfile(Constant(100))
+	next := nextDue(p, now)
+	assert.True(t, next.After(now))
+	assert.False(t, next.After(now.Add(10*time.Millisecond)))
+}
@@ -0,0 +1,173 @@
+package pacer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Profile describes the target request rate, in requests per second across
+// all request threads, over the course of a run.
+type Profile interface {
+	// Rate returns the target rate at the given time since the start of the run.
+	Rate(elapsed time.Duration) float64
+	String() string
+}
+
+// Constant keeps the same rate for the whole run.
+type Constant float64
+
+func (c Constant) Rate(time.Duration) float64 {
+	return float64(c)
+}
+
+func (c Constant) String() string {
+	return formatRate(float64(c))
+}
+
+// Ramp changes the rate linearly from From to To over Duration and then holds To.
+type Ramp struct {
+	From     float64
+	To       float64
+	Duration time.Duration
+}
+
+func (r Ramp) Rate(elapsed time.Duration) float64 {
+	if elapsed >= r.Duration {
+		return r.To
+	}
+	progress := float64(elapsed) / float64(r.Duration)
+	return r.From + (r.To-r.From)*progress
+}
+
+func (r Ramp) String() string {
+	return fmt.Sprintf("ramp:%s:%s:%s", formatRate(r.From), formatRate(r.To), r.Duration)
+}
+
+// Step starts at From and adds Increment every Every.
+type Step struct {
+	From      float64
+	Increment float64
+	Every     time.Duration
+}
+
+func (s Step) Rate(elapsed time.Duration) float64 {
+	steps := math.Floor(float64(elapsed) / float64(s.Every))
+	return math.Max(s.From+s.Increment*steps, 0)
+}
+
+func (s Step) String() string {
+	return fmt.Sprintf("step:%s:%s:%s", formatRate(s.From), formatRate(s.Increment), s.Every)
+}
+
+// Sine oscillates the rate around Mean by Amplitude with the given Period.
+type Sine struct {
+	Mean      float64
+	Amplitude float64
+	Period    time.Duration
+}
+
+func (s Sine) Rate(elapsed time.Duration) float64 {
+	phase := 2 * math.Pi * float64(elapsed) / float64(s.Period)
+	return math.Max(s.Mean+s.Amplitude*math.Sin(phase), 0)
+}
+
+func (s Sine) String() string {
+	return fmt.Sprintf("sine:%s:%s:%s", formatRate(s.Mean), formatRate(s.Amplitude), s.Period)
+}
+
+// ParseProfile parses a rate profile specification. Supported forms are:
+//
+//	ramp:FROM:TO:DURATION    linear ramp from FROM to TO req/s over DURATION
+//	step:FROM:STEP:N         start at FROM req/s and add STEP every N intervals
+//	sine:MEAN:AMPLITUDE:PERIOD
+//
+// interval is the reporting interval that step profiles are expressed in.
+func ParseProfile(spec string, interval time.Duration) (Profile, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid rate profile '%s': expected KIND:A:B:C", spec)
+	}
+	first, err := parseRate(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate profile '%s': %s", spec, err)
+	}
+	second, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate profile '%s': %s", spec, err)
+	}
+
+	switch parts[0] {
+	case "ramp":
+		duration, err := parsePositiveDuration(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate profile '%s': %s", spec, err)
+		}
+		if second < 0 {
+			return nil, fmt.Errorf("invalid rate profile '%s': rate cannot be negative", spec)
+		}
+		return Ramp{From: first, To: second, Duration: duration}, nil
+	case "step":
+		every, err := strconv.Atoi(parts[3])
+		if err != nil || every < 1 {
+			return nil, fmt.Errorf("invalid rate profile '%s': step interval count must be a positive integer", spec)
+		}
+		if second < 0 {
+			return nil, fmt.Errorf("invalid rate profile '%s': step cannot be negative", spec)
+		}
+		return Step{From: first, Increment: second, Every: time.Duration(every) * interval}, nil
+	case "sine":
+		period, err := parsePositiveDuration(parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate profile '%s': %s", spec, err)
+		}
+		return Sine{Mean: first, Amplitude: second, Period: period}, nil
+	default:
+		return nil, fmt.Errorf("invalid rate profile '%s': unknown kind '%s', expected [ramp | step | sine]", spec, parts[0])
+	}
+}
+
+// Requests returns the number of requests the profile expects to be sent
+// between from and to.
+func Requests(profile Profile, from, to time.Duration) float64 {
+	if timeline, ok := profile.(*Timeline); ok {
+		return float64(timeline.requests(from, to))
+	}
+	total := 0.0
+	for t := from; t < to; t += maxStep {
+		step := maxStep
+		if t+step > to {
+			step = to - t
+		}
+		total += profile.Rate(t+step/2) * step.Seconds()
+	}
+	return total
+}
+
+func parseRate(text string) (float64, error) {
+	rate, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 {
+		return 0, fmt.Errorf("rate cannot be negative")
+	}
+	return rate, nil
+}
+
+func parsePositiveDuration(text string) (time.Duration, error) {
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("duration must be positive")
+	}
+	return duration, nil
+}
+
+func formatRate(rate float64) string {
+	return strconv.FormatFloat(rate, 'f', -1, 64)
+}
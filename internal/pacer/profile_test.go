@@ -0,0 +1,65 @@
+package pacer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseProfileOk(t *testing.T) {
+	profile, err := ParseProfile("ramp:100:500:1m", 10*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, Ramp{From: 100, To: 500, Duration: time.Minute}, profile)
+
+	// Ramping down to zero is fine, the pacer waits for the rate to pick up.
+	profile, err = ParseProfile("ramp:100:0:1m", 10*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, Ramp{From: 100, To: 0, Duration: time.Minute}, profile)
+
+	profile, err = ParseProfile("step:10:5:3", 10*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, Step{From: 10, Increment: 5, Every: 30 * time.Second}, profile)
+
+	profile, err = ParseProfile("sine:300:100.5:2m", 10*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, Sine{Mean: 300, Amplitude: 100.5, Period: 2 * time.Minute}, profile)
+	assert.Equal(t, "sine:300:100.5:2m0s", profile.String())
+}
+
+func TestParseProfileErrorOk(t *testing.T) {
+	for _, spec := range []string{
+		"ramp:100:500",
+		"ramp:100:-1:1m",
+		"step:10:-5:3",
+		"ramp:100:500:0s",
+		"step:10:5:0",
+		"sine:x:1:1m",
+		"square:1:2:3",
+	} {
+		_, err := ParseProfile(spec, time.Second)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestProfileRatesOk(t *testing.T) {
+	ramp := Ramp{From: 100, To: 500, Duration: time.Minute}
+	assert.Equal(t, 100.0, ramp.Rate(0))
+	assert.Equal(t, 300.0, ramp.Rate(30*time.Second))
+	assert.Equal(t, 500.0, ramp.Rate(2*time.Minute))
+
+	step := Step{From: 10, Increment: 5, Every: 30 * time.Second}
+	assert.Equal(t, 10.0, step.Rate(29*time.Second))
+	assert.Equal(t, 15.0, step.Rate(30*time.Second))
+	assert.Equal(t, 20.0, step.Rate(time.Minute))
+
+	sine := Sine{Mean: 300, Amplitude: 100, Period: time.Minute}
+	assert.InDelta(t, 300.0, sine.Rate(0), 0.001)
+	assert.InDelta(t, 400.0, sine.Rate(15*time.Second), 0.001)
+	assert.InDelta(t, 200.0, sine.Rate(45*time.Second), 0.001)
+}
+
+func TestRequestsOk(t *testing.T) {
+	assert.InDelta(t, 1000.0, Requests(Constant(100), 0, 10*time.Second), 0.001)
+	ramp := Ramp{From: 0, To: 100, Duration: 10 * time.Second}
+	assert.InDelta(t, 500.0, Requests(ramp, 0, 10*time.Second), 0.001)
+}
@@ -0,0 +1,92 @@
+package pacer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Timeline hands out the times at which recorded requests should be sent to
+// replay them with their original timing. It is also the Profile of the
+// replay, whose rate is that of the recording.
+type Timeline struct {
+	mu      sync.Mutex
+	offsets []time.Duration
+	start   time.Time
+	// shift is how much later the replay runs than planned at start,
+	// because of pauses.
+	shift time.Duration
+	next  int
+}
+
+// NewTimeline returns a Timeline sending request i at start plus offsets[i].
+// The offsets must be sorted.
+func NewTimeline(offsets []time.Duration, start time.Time) *Timeline {
+	return &Timeline{offsets: offsets, start: start}
+}
+
+// Next returns the index of the next request and the time at which it should
+// be sent, or false once every request was handed out.
+func (t *Timeline) Next() (int, time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.next == len(t.offsets) {
+		return 0, time.Time{}, false
+	}
+	i := t.next
+	t.next++
+	return i, t.start.Add(t.shift + t.offsets[i]), true
+}
+
+// Skip delays the rest of the replay so that the next request is due at now
+// if it was due earlier, so that it resumes where it was after a pause
+// instead of catching up.
+func (t *Timeline) Skip(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.next == len(t.offsets) {
+		return
+	}
+	if due := t.start.Add(t.shift + t.offsets[t.next]); due.Before(now) {
+		t.shift += now.Sub(due)
+	}
+}
+
+// Rate returns the rate of the recording around the given time since the
+// start of the replay, averaged over maxStep.
+func (t *Timeline) Rate(elapsed time.Duration) float64 {
+	t.mu.Lock()
+	at := elapsed - t.shift
+	t.mu.Unlock()
+	from := at.Truncate(maxStep)
+	return float64(t.count(from, from+maxStep)) / maxStep.Seconds()
+}
+
+// requests returns the number of requests due between from and to since the
+// start of the replay.
+func (t *Timeline) requests(from, to time.Duration) int {
+	t.mu.Lock()
+	shift := t.shift
+	t.mu.Unlock()
+	return t.count(from-shift, to-shift)
+}
+
+// count returns the number of offsets between from included and to excluded.
+func (t *Timeline) count(from, to time.Duration) int {
+	first := sort.Search(len(t.offsets), func(i int) bool { return t.offsets[i] >= from })
+	last := sort.Search(len(t.offsets), func(i int) bool { return t.offsets[i] >= to })
+	return last - first
+}
+
+// Duration returns the time between the first and last requests.
+func (t *Timeline) Duration() time.Duration {
+	if len(t.offsets) == 0 {
+		return 0
+	}
+	return t.offsets[len(t.offsets)-1]
+}
+
+func (t *Timeline) String() string {
+	return fmt.Sprintf("recorded timing over %s", t.Duration())
+}
@@ -0,0 +1,42 @@
+package pacer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTimelineReplaysOffsets(t *testing.T) {
+	start := time.Now()
+	timeline := NewTimeline([]time.Duration{0, 50 * time.Millisecond, 2 * time.Second}, start)
+	for i, want := range []time.Duration{0, 50 * time.Millisecond, 2 * time.Second} {
+		index, at, ok := timeline.Next()
+		assert.True(t, ok)
+		assert.Equal(t, i, index)
+		assert.Equal(t, start.Add(want), at)
+	}
+	_, _, ok := timeline.Next()
+	assert.False(t, ok)
+	assert.Equal(t, "recorded timing over 2s", timeline.String())
+}
+
+func TestTimelineSkipResumesWhereItWas(t *testing.T) {
+	start := time.Now()
+	timeline := NewTimeline([]time.Duration{0, time.Second, 2 * time.Second}, start)
+	timeline.Next()
+	// Paused for 3s from 500ms in.
+	timeline.Skip(start.Add(3500 * time.Millisecond))
+	_, at, _ := timeline.Next()
+	assert.Equal(t, start.Add(3500*time.Millisecond), at)
+	_, at, _ = timeline.Next()
+	assert.Equal(t, start.Add(4500*time.Millisecond), at)
+}
+
+func TestTimelineRate(t *testing.T) {
+	timeline := NewTimeline([]time.Duration{0, 10 * time.Millisecond, 20 * time.Millisecond, time.Second}, time.Now())
+	assert.Equal(t, 30.0, timeline.Rate(50*time.Millisecond))
+	assert.Equal(t, 0.0, timeline.Rate(500*time.Millisecond))
+	assert.Equal(t, 10.0, timeline.Rate(time.Second))
+	assert.Equal(t, 4.0, Requests(timeline, 0, 2*time.Second))
+	assert.Equal(t, 1.0, Requests(timeline, 15*time.Millisecond, 999*time.Millisecond))
+}
@@ -0,0 +1,233 @@
+package plan
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vspaz/slow_cooker/internal/pacer"
+	"github.com/vspaz/slow_cooker/internal/validate"
+	"github.com/vspaz/slow_cooker/internal/weighted"
+	"gopkg.in/yaml.v3"
+)
+
+// Stage is one step of a test plan, or one of several scenarios run at the
+// same time. Zero values mean the stage inherits the corresponding command
+// line flag.
+type Stage struct {
+	Name        string
+	Duration    time.Duration
+	Profile     pacer.Profile
+	Concurrency int
+	Method      string
+	Urls        []string
+	Hosts       []string
+	HostWeights []float64
+	Headers     http.Header
+	Body        []byte
+}
+
+// rawStage is a stage as written in the plan file.
+type rawStage struct {
+	Name        string            `yaml:"name"`
+	Duration    string            `yaml:"duration"`
+	Rate        float64           `yaml:"rate"`
+	RateProfile string            `yaml:"rateProfile"`
+	Concurrency int               `yaml:"concurrency"`
+	Method      string            `yaml:"method"`
+	Urls        []string          `yaml:"urls"`
+	Host        string            `yaml:"host"`
+	Headers     map[string]string `yaml:"headers"`
+	Body        *string           `yaml:"body"`
+	BodyFile    string            `yaml:"bodyFile"`
+}
+
+var stageFields = []string{
+	"name", "duration", "rate", "rateProfile", "concurrency", "method", "urls", "host", "headers", "body", "bodyFile",
+}
+
+var scenarioFields = []string{
+	"name", "rate", "rateProfile", "concurrency", "method", "urls", "host", "headers", "body", "bodyFile",
+}
+
+// Load reads and validates the plan at path, which can be written in YAML or
+// JSON. All problems found are reported together, each prefixed with the
+// file name and line number it was found on. interval is the reporting
+// interval that step rate profiles are expressed in.
+func Load(path string, interval time.Duration) ([]Stage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data, interval)
+}
+
+// LoadScenarios reads and validates a file of scenarios, which are written
+// like the stages of a plan but have no duration and a unique name.
+func LoadScenarios(path string, interval time.Duration) ([]Stage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseScenarios(path, data, interval)
+}
+
+// Parse validates a plan read from the named file.
+func Parse(name string, data []byte, interval time.Duration) ([]Stage, error) {
+	return parse(name, data, interval, false)
+}
+
+// ParseScenarios validates scenarios read from the named file.
+func ParseScenarios(name string, data []byte, interval time.Duration) ([]Stage, error) {
+	return parse(name, data, interval, true)
+}
+
+func parse(name string, data []byte, interval time.Duration, scenarios bool) ([]Stage, error) {
+	list, label, fields := "stages", "stage", stageFields
+	if scenarios {
+		list, label, fields = "scenarios", "scenario", scenarioFields
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	if len(document.Content) == 0 {
+		return nil, fmt.Errorf("%s: the file is empty", name)
+	}
+
+	root := document.Content[0]
+	v := validator{Validator: validate.New(name), dir: filepath.Dir(name)}
+	if root.Kind != yaml.MappingNode {
+		v.Fail(root, "expected a mapping with a '%s' list", list)
+		return nil, v.Err()
+	}
+	v.CheckFields(root, "the file", []string{list})
+	stagesNode := validate.Field(root, list)
+	if stagesNode == nil || stagesNode.Kind != yaml.SequenceNode || len(stagesNode.Content) == 0 {
+		v.Fail(root, "expected a non-empty '%s' list", list)
+		return nil, v.Err()
+	}
+
+	var stages []Stage
+	names := make(map[string]bool)
+	for i, node := range stagesNode.Content {
+		stage := v.stage(fmt.Sprintf("%s %d", label, i+1), node, interval, fields, !scenarios)
+		if scenarios {
+			if validate.Field(node, "name") == nil {
+				v.Fail(node, "%s: name is required", stage.Name)
+			} else if names[stage.Name] {
+				v.Fail(validate.Field(node, "name"), "%s %d (%s): duplicate name", label, i+1, stage.Name)
+			}
+			names[stage.Name] = true
+		}
+		stages = append(stages, stage)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return stages, nil
+}
+
+// validator validates a plan or scenario file. dir is the directory of the
+// file, against which relative bodyFile paths are resolved.
+type validator struct {
+	*validate.Validator
+	dir string
+}
+
+// stage validates a stage or scenario, which is described as what in errors
+// until its name is known.
+func (v *validator) stage(what string, node *yaml.Node, interval time.Duration, fields []string, requireDuration bool) Stage {
+	var raw rawStage
+	if !v.Decode(node, what, &raw) {
+		return Stage{}
+	}
+	stage := Stage{
+		Name:        raw.Name,
+		Concurrency: raw.Concurrency,
+		Method:      raw.Method,
+	}
+	for name, value := range raw.Headers {
+		if stage.Headers == nil {
+			stage.Headers = make(http.Header)
+		}
+		stage.Headers.Set(name, value)
+	}
+	if raw.Name != "" {
+		what = fmt.Sprintf("%s (%s)", what, raw.Name)
+	} else {
+		stage.Name = what
+	}
+	v.CheckFields(node, what, fields)
+
+	if raw.Host != "" {
+		hosts, weights, err := weighted.ParseList(raw.Host)
+		if err != nil {
+			v.Fail(validate.Field(node, "host"), "%s: %s", what, err)
+		}
+		stage.Hosts, stage.HostWeights = hosts, weights
+	}
+
+	if validate.Field(node, "duration") == nil {
+		if requireDuration {
+			v.Fail(node, "%s: duration is required", what)
+		}
+	} else if duration, err := time.ParseDuration(raw.Duration); err != nil || duration <= 0 {
+		v.Fail(validate.Field(node, "duration"), "%s: invalid duration '%s'", what, raw.Duration)
+	} else {
+		stage.Duration = duration
+	}
+
+	if raw.Rate < 0 {
+		v.Fail(validate.Field(node, "rate"), "%s: rate cannot be negative", what)
+	} else if raw.Rate > 0 && raw.RateProfile != "" {
+		v.Fail(validate.Field(node, "rateProfile"), "%s: rate and rateProfile cannot be used together", what)
+	} else if raw.Rate > 0 {
+		stage.Profile = pacer.Constant(raw.Rate)
+	} else if raw.RateProfile != "" {
+		profile, err := pacer.ParseProfile(raw.RateProfile, interval)
+		if err != nil {
+			v.Fail(validate.Field(node, "rateProfile"), "%s: %s", what, err)
+		}
+		stage.Profile = profile
+	}
+
+	if raw.Concurrency < 0 {
+		v.Fail(validate.Field(node, "concurrency"), "%s: concurrency must be at least 1", what)
+	}
+
+	if urlsNode := validate.Field(node, "urls"); urlsNode != nil {
+		if len(raw.Urls) == 0 {
+			v.Fail(urlsNode, "%s: urls cannot be empty", what)
+		}
+		for i, rawURL := range raw.Urls {
+			if URL, err := validate.URL(rawURL); err != nil {
+				v.Fail(urlsNode.Content[i], "%s: %s", what, err)
+			} else {
+				stage.Urls = append(stage.Urls, URL)
+			}
+		}
+	}
+
+	if raw.Body != nil && raw.BodyFile != "" {
+		v.Fail(validate.Field(node, "bodyFile"), "%s: body and bodyFile cannot be used together", what)
+	} else if raw.Body != nil {
+		stage.Body = []byte(*raw.Body)
+	} else if raw.BodyFile != "" {
+		// Relative paths are resolved against the directory of the plan.
+		path := raw.BodyFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(v.dir, path)
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			v.Fail(validate.Field(node, "bodyFile"), "%s: %s", what, err)
+		}
+		stage.Body = body
+	}
+
+	return stage
+}
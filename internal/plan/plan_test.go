@@ -0,0 +1,105 @@
+package plan
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/vspaz/slow_cooker/internal/pacer"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseYamlPlanOk(t *testing.T) {
+	stages, err := Parse("plan.yaml", []byte(`
+stages:
+  - name: warm
+    duration: 1m
+    rate: 10
+  - duration: 5m
+    rateProfile: ramp:10:100:5m
+    concurrency: 20
+    method: GET
+    urls:
+      - http://localhost:4140/foo
+      - http://localhost:4140/bar
+    headers:
+      X-Test: "yes"
+    body: hello
+`), 10*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(stages))
+	assert.Equal(t, Stage{Name: "warm", Duration: time.Minute, Profile: pacer.Constant(10)}, stages[0])
+	assert.Equal(t, Stage{
+		Name:        "stage 2",
+		Duration:    5 * time.Minute,
+		Profile:     pacer.Ramp{From: 10, To: 100, Duration: 5 * time.Minute},
+		Concurrency: 20,
+		Method:      "GET",
+		Urls:        []string{"http://localhost:4140/foo", "http://localhost:4140/bar"},
+		Headers:     http.Header{"X-Test": {"yes"}},
+		Body:        []byte("hello"),
+	}, stages[1])
+}
+
+func TestParseJsonPlanOk(t *testing.T) {
+	stages, err := Parse("plan.json", []byte(`{"stages": [{"name": "only", "duration": "30s", "rate": 0.5}]}`), time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, []Stage{{Name: "only", Duration: 30 * time.Second, Profile: pacer.Constant(0.5)}}, stages)
+}
+
+func TestParsePlanErrorsOk(t *testing.T) {
+	_, err := Parse("plan.yaml", []byte(`stages:
+  - name: first
+    rate: -1
+  - name: second
+    duration: soon
+    urls:
+      - http://localhost:4140/
+      - localhost:4140
+    concurency: 3
+`), time.Second)
+	assert.EqualError(t, err, `plan.yaml:2: stage 1 (first): duration is required
+plan.yaml:3: stage 1 (first): rate cannot be negative
+plan.yaml:9: stage 2 (second): unknown field 'concurency'
+plan.yaml:5: stage 2 (second): invalid duration 'soon'
+plan.yaml:8: stage 2 (second): invalid URL 'localhost:4140': Missing host`)
+}
+
+func TestParseEmptyPlanOk(t *testing.T) {
+	_, err := Parse("plan.yaml", []byte(""), time.Second)
+	assert.EqualError(t, err, "plan.yaml: the file is empty")
+	_, err = Parse("plan.yaml", []byte("stages: []"), time.Second)
+	assert.EqualError(t, err, "plan.yaml:1: expected a non-empty 'stages' list")
+}
+
+func TestParseScenariosOk(t *testing.T) {
+	scenarios, err := ParseScenarios("scenarios.yaml", []byte(`
+scenarios:
+  - name: web_a
+    host: web_a
+    rate: 100
+  - name: web_b
+    host: web_b=1,web_c=3
+    rate: 200
+    concurrency: 5
+`), time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, []Stage{
+		{Name: "web_a", Profile: pacer.Constant(100), Hosts: []string{"web_a"}, HostWeights: []float64{1}},
+		{Name: "web_b", Profile: pacer.Constant(200), Concurrency: 5, Hosts: []string{"web_b", "web_c"}, HostWeights: []float64{1, 3}},
+	}, scenarios)
+}
+
+func TestParseScenariosErrorsOk(t *testing.T) {
+	_, err := ParseScenarios("scenarios.yaml", []byte(`scenarios:
+  - rate: 100
+  - name: web_a
+    duration: 1m
+  - name: web_a
+  - name: web_b
+    host: web_b=heavy
+`), time.Second)
+	assert.EqualError(t, err, `scenarios.yaml:2: scenario 1: name is required
+scenarios.yaml:4: scenario 2 (web_a): unknown field 'duration'
+scenarios.yaml:5: scenario 3 (web_a): duplicate name
+scenarios.yaml:7: scenario 4 (web_b): invalid weight in 'web_b=heavy': must be a positive number`)
+}
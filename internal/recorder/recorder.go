@@ -0,0 +1,214 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/vspaz/slow_cooker/internal/cli"
+	"github.com/vspaz/slow_cooker/internal/reqspec"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// maxBodySize is the largest request body recorded. Larger requests are
+// rejected instead of being read into memory.
+const maxBodySize = 32 << 20
+
+// skippedHeaders only concern the connection to the recorder, or are set by
+// the HTTP client from the URL and body of a request, and aren't recorded.
+var skippedHeaders = map[string]bool{
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Te":                true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Content-Length":    true,
+}
+
+// Recorder is a reverse proxy that writes the requests it forwards to a
+// request spec file, to replay them later with -requests. Bodies that aren't
+// UTF-8 text are saved to files of their own next to it.
+type Recorder struct {
+	proxy *httputil.ReverseProxy
+	base  *url.URL
+	path  string
+
+	mu     sync.Mutex
+	file   *os.File
+	out    *bufio.Writer
+	count  int
+	bodies int
+	err    error
+}
+
+// New returns a Recorder forwarding requests to upstream and writing them to
+// the file at path, with base in place of upstream in their URLs. The file
+// must not exist yet, so that a previous recording isn't overwritten.
+func New(upstream *url.URL, base *url.URL, path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%s already exists, pick another file to record to", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		proxy: httputil.NewSingleHostReverseProxy(upstream),
+		base:  base,
+		path:  path,
+		file:  file,
+		out:   bufio.NewWriter(file),
+	}, nil
+}
+
+func (r *Recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	received := time.Now()
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("the request body is larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading the request body: %s", err), http.StatusBadRequest)
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	r.record(req, body, received)
+	r.proxy.ServeHTTP(w, req)
+}
+
+// record writes a request. Failing to record it doesn't keep it from being
+// forwarded, but is reported once.
+func (r *Recorder) record(req *http.Request, body []byte, received time.Time) {
+	request := reqspec.Request{
+		Method:    req.Method,
+		URL:       r.recordedURL(req.URL),
+		Header:    make(http.Header),
+		Weight:    1,
+		Timestamp: received,
+	}
+	for name, values := range req.Header {
+		if !skippedHeaders[name] {
+			request.Header[name] = values
+		}
+	}
+	if len(body) > 0 {
+		request.Body = body
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	bodyFile := ""
+	if !utf8.Valid(body) {
+		r.bodies++
+		bodyFile = filepath.Join(filepath.Base(r.path)+".bodies", strconv.Itoa(r.bodies))
+		r.err = r.saveBody(bodyFile, body)
+	}
+	if r.err == nil {
+		r.err = reqspec.Write(r.out, request, bodyFile)
+	}
+	if r.err == nil {
+		// Flush every request so that the file holds what was recorded so
+		// far even if the recorder doesn't exit cleanly.
+		r.err = r.out.Flush()
+	}
+	if r.err != nil {
+		fmt.Fprintf(os.Stderr, "recording failed, requests are only forwarded from now on: %s\n", r.err)
+		return
+	}
+	r.count++
+}
+
+// saveBody writes a body to bodyFile, relative to the directory of the
+// recorded requests.
+func (r *Recorder) saveBody(bodyFile string, body []byte) error {
+	path := filepath.Join(filepath.Dir(r.path), bodyFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, body, 0o644)
+}
+
+// recordedURL returns the URL of a request forwarded upstream, with base in
+// place of the upstream URL.
+func (r *Recorder) recordedURL(URL *url.URL) string {
+	recorded := *r.base
+	recorded.Path = strings.TrimSuffix(r.base.Path, "/") + URL.Path
+	recorded.RawPath = ""
+	if URL.RawPath != "" {
+		recorded.RawPath = strings.TrimSuffix(r.base.EscapedPath(), "/") + URL.RawPath
+	}
+	recorded.RawQuery = URL.RawQuery
+	return recorded.String()
+}
+
+// Count returns the number of requests recorded so far.
+func (r *Recorder) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+// Close flushes the recorded requests to their file and closes it.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return errors.Join(r.out.Flush(), r.file.Close())
+}
+
+// Run records the requests sent to the listening address until SIGINT or
+// SIGTERM.
+func Run(arguments []string) {
+	args := cli.GetRecordArgs(arguments)
+	recorder, err := New(args.Upstream, args.Base, args.Out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	server := &http.Server{Addr: args.Listen, Handler: recorder}
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, syscall.SIGINT, syscall.SIGTERM)
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+	fmt.Printf("# recording requests to %s forwarded to %s in %s ...\n", args.Listen, args.Upstream, args.Out)
+
+	select {
+	case err = <-served:
+	case <-interrupted:
+		// Let the requests in flight complete so that they are recorded
+		// with their whole body.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = server.Shutdown(ctx)
+		cancel()
+	}
+	if closeErr := recorder.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	fmt.Printf("# recorded %d requests in %s\n", recorder.Count(), args.Out)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
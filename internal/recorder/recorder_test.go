@@ -0,0 +1,107 @@
+package recorder
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vspaz/slow_cooker/internal/reqspec"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorderForwardsAndRecordsRequests(t *testing.T) {
+	var forwarded []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		forwarded = append(forwarded, req.Method+" "+req.URL.String()+" "+string(body))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	base, _ := url.Parse("http://staging.test:8080/api")
+
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	recorder, err := New(upstreamURL, base, path)
+	require.NoError(t, err)
+	proxy := httptest.NewServer(recorder)
+	defer proxy.Close()
+
+	start := time.Now()
+	req, _ := http.NewRequest("POST", proxy.URL+"/items?a=1", strings.NewReader(`{"id": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, err = http.Post(proxy.URL+"/upload", "application/octet-stream", strings.NewReader("\xff\xfe"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = http.Get(proxy.URL + "/items")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.NoError(t, recorder.Close())
+
+	assert.Equal(t, []string{"POST /items?a=1 {\"id\": 1}", "POST /upload \xff\xfe", "GET /items "}, forwarded)
+	assert.Equal(t, 3, recorder.Count())
+	requests, err := reqspec.Load(path)
+	require.NoError(t, err)
+	require.Len(t, requests, 3)
+	assert.Equal(t, "POST", requests[0].Method)
+	assert.Equal(t, "http://staging.test:8080/api/items?a=1", requests[0].URL)
+	assert.Equal(t, "application/json", requests[0].Header.Get("Content-Type"))
+	assert.Empty(t, requests[0].Header.Get("Content-Length"))
+	assert.Equal(t, []byte(`{"id": 1}`), requests[0].Body)
+	assert.WithinDuration(t, start, requests[0].Timestamp, time.Second)
+	assert.Equal(t, []byte("\xff\xfe"), requests[1].Body)
+	assert.Nil(t, requests[2].Body)
+	assert.False(t, requests[2].Timestamp.Before(requests[1].Timestamp))
+
+	saved, err := os.ReadFile(filepath.Join(filepath.Dir(path), "requests.jsonl.bodies", "1"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\xff\xfe"), saved)
+}
+
+func TestRecorderKeepsExistingFile(t *testing.T) {
+	upstream, _ := url.Parse("http://localhost:4140")
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0o644))
+
+	_, err := New(upstream, upstream, path)
+	assert.EqualError(t, err, path+" already exists, pick another file to record to")
+	kept, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "{}\n", string(kept))
+}
+
+func TestRecorderWritesEveryRequest(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer upstream.Close()
+	upstreamURL, _ := url.Parse(upstream.URL)
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	recorder, err := New(upstreamURL, upstreamURL, path)
+	require.NoError(t, err)
+	defer recorder.Close()
+	proxy := httptest.NewServer(recorder)
+	defer proxy.Close()
+
+	resp, err := http.Get(proxy.URL + "/items")
+	require.NoError(t, err)
+	resp.Body.Close()
+	// The request is in the file before the recorder is closed.
+	requests, err := reqspec.Load(path)
+	require.NoError(t, err)
+	require.Len(t, requests, 1)
+	assert.Equal(t, upstream.URL+"/items", requests[0].URL)
+
+	resp, err = http.Post(proxy.URL+"/upload", "application/octet-stream", strings.NewReader(strings.Repeat("x", maxBodySize+1)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Equal(t, 1, recorder.Count())
+}
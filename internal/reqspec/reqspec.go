@@ -0,0 +1,239 @@
+package reqspec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/vspaz/slow_cooker/internal/validate"
+)
+
+// maxLineSize bounds the length of a line, which holds the body of its
+// request.
+const maxLineSize = 16 * 1024 * 1024
+
+// Request is a request described by a line of a request spec file. Zero
+// values mean the request inherits the corresponding command line flag.
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+	// Weight is the share of the traffic the request gets relative to the
+	// other requests.
+	Weight float64
+	// ExpectStatus is the status code of a good response, any 2xx if zero.
+	ExpectStatus int
+	// Timestamp is when the request was recorded, zero if unknown.
+	Timestamp time.Time
+}
+
+// rawRequest is a request as written in the file.
+type rawRequest struct {
+	Method       string                  `json:"method,omitempty"`
+	URL          string                  `json:"url"`
+	Headers      map[string]headerValues `json:"headers,omitempty"`
+	Body         *string                 `json:"body,omitempty"`
+	BodyFile     string                  `json:"bodyFile,omitempty"`
+	Weight       *float64                `json:"weight,omitempty"`
+	ExpectStatus int                     `json:"expectStatus,omitempty"`
+	Timestamp    string                  `json:"timestamp,omitempty"`
+}
+
+// headerValues are the values of a header, written as a string or a list of
+// strings.
+type headerValues []string
+
+func (v *headerValues) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*v = headerValues{value}
+		return nil
+	}
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return errors.New("header values must be a string or a list of strings")
+	}
+	*v = values
+	return nil
+}
+
+func (v headerValues) MarshalJSON() ([]byte, error) {
+	if len(v) == 1 {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal([]string(v))
+}
+
+// Load reads and validates the request spec at path.
+func Load(path string) ([]Request, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(path, file)
+}
+
+// Parse validates the request spec of the named file read from r, which has
+// a JSON object per line. Blank lines are skipped. All problems found are
+// reported together, each prefixed with the file name and line number it was
+// found on. Relative bodyFile paths are resolved against the directory of the
+// file.
+func Parse(name string, r io.Reader) ([]Request, error) {
+	dir := filepath.Dir(name)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+
+	var requests []Request
+	var errs []error
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		request, err := parseLine(text, dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %s", name, line, err))
+			continue
+		}
+		requests = append(requests, request)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %s", name, err))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("%s: the file has no requests", name)
+	}
+	return requests, nil
+}
+
+func parseLine(text []byte, dir string) (Request, error) {
+	var raw rawRequest
+	decoder := json.NewDecoder(bytes.NewReader(text))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&raw); err != nil {
+		return Request{}, err
+	}
+	if decoder.More() {
+		return Request{}, errors.New("expected a single JSON object")
+	}
+
+	request := Request{
+		Method:       raw.Method,
+		Weight:       1,
+		ExpectStatus: raw.ExpectStatus,
+	}
+	if raw.URL == "" {
+		return Request{}, errors.New("url is required")
+	}
+	URL, err := validate.URL(raw.URL)
+	if err != nil {
+		return Request{}, err
+	}
+	request.URL = URL
+
+	if raw.Headers != nil {
+		request.Header = make(http.Header)
+		for name, values := range raw.Headers {
+			for _, value := range values {
+				request.Header.Add(name, value)
+			}
+		}
+	}
+
+	if raw.Body != nil && raw.BodyFile != "" {
+		return Request{}, errors.New("body and bodyFile cannot be used together")
+	} else if raw.Body != nil {
+		request.Body = []byte(*raw.Body)
+	} else if raw.BodyFile != "" {
+		path := raw.BodyFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return Request{}, err
+		}
+		request.Body = body
+	}
+
+	if raw.Weight != nil {
+		if *raw.Weight <= 0 {
+			return Request{}, errors.New("weight must be positive")
+		}
+		request.Weight = *raw.Weight
+	}
+	if raw.ExpectStatus != 0 && (raw.ExpectStatus < 100 || raw.ExpectStatus > 599) {
+		return Request{}, fmt.Errorf("invalid expectStatus %d", raw.ExpectStatus)
+	}
+	if raw.Timestamp != "" {
+		timestamp, err := time.Parse(time.RFC3339Nano, raw.Timestamp)
+		if err != nil {
+			return Request{}, fmt.Errorf("invalid timestamp '%s'", raw.Timestamp)
+		}
+		request.Timestamp = timestamp
+	}
+	return request, nil
+}
+
+// Write writes request to w as a line of a request spec file. Its body is
+// written inline, unless bodyFile is set to the file it was saved to.
+func Write(w io.Writer, request Request, bodyFile string) error {
+	raw := rawRequest{
+		Method:       request.Method,
+		URL:          request.URL,
+		BodyFile:     bodyFile,
+		ExpectStatus: request.ExpectStatus,
+	}
+	if len(request.Header) > 0 {
+		raw.Headers = make(map[string]headerValues, len(request.Header))
+		for name, values := range request.Header {
+			raw.Headers[name] = values
+		}
+	}
+	if bodyFile == "" && request.Body != nil {
+		body := string(request.Body)
+		raw.Body = &body
+	}
+	if request.Weight != 1 && request.Weight != 0 {
+		raw.Weight = &request.Weight
+	}
+	if !request.Timestamp.IsZero() {
+		raw.Timestamp = request.Timestamp.Format(time.RFC3339Nano)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(raw)
+}
+
+// Offsets returns a copy of requests sorted by timestamp, and the time of
+// each relative to the first one, or an error if a request has no timestamp.
+func Offsets(requests []Request) ([]Request, []time.Duration, error) {
+	for i, request := range requests {
+		if request.Timestamp.IsZero() {
+			return nil, nil, fmt.Errorf("request %d has no timestamp", i+1)
+		}
+	}
+	sorted := make([]Request, len(requests))
+	copy(sorted, requests)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+	offsets := make([]time.Duration, len(sorted))
+	for i, request := range sorted {
+		offsets[i] = request.Timestamp.Sub(sorted[0].Timestamp)
+	}
+	return sorted, offsets, nil
+}
@@ -0,0 +1,112 @@
+package reqspec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRequestsOk(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "body.json"), []byte(`{"id": 1}`), 0o644))
+
+	requests, err := Parse(filepath.Join(dir, "requests.jsonl"), strings.NewReader(`
+{"url": "http://localhost:4140/"}
+{"method": "PUT", "url": "http://localhost:4140/items", "headers": {"accept": ["a", "b"], "X-Test": "yes"}, "bodyFile": "body.json", "weight": 2.5, "expectStatus": 201}
+
+{"method": "POST", "url": "http://localhost:4140/{{.RequestID}}", "body": ""}
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []Request{
+		{URL: "http://localhost:4140/", Weight: 1},
+		{
+			Method:       "PUT",
+			URL:          "http://localhost:4140/items",
+			Header:       http.Header{"Accept": {"a", "b"}, "X-Test": {"yes"}},
+			Body:         []byte(`{"id": 1}`),
+			Weight:       2.5,
+			ExpectStatus: 201,
+		},
+		{Method: "POST", URL: "http://localhost:4140/{{.RequestID}}", Body: []byte{}, Weight: 1},
+	}, requests)
+}
+
+func TestParseRequestsErrorsOk(t *testing.T) {
+	_, err := Parse("requests.jsonl", strings.NewReader(`{"url": "localhost:4140"}
+{"method": "GET"}
+{"url": "http://localhost:4140/", "weight": 0}
+{"url": "http://localhost:4140/", "body": "a", "bodyFile": "b"}
+{"url": "http://localhost:4140/", "expectStatus": 42}
+{"url": "http://localhost:4140/", "headers": {"X-Test": 1}}
+{"url": "http://localhost:4140/", "wieght": 1}
+{"url": "http://localhost:4140/"} {"url": "http://localhost:4140/"}
+not json
+{"url": "http://localhost:4140/", "timestamp": "today"}
+`))
+	assert.EqualError(t, err, `requests.jsonl:1: invalid URL 'localhost:4140': Missing host
+requests.jsonl:2: url is required
+requests.jsonl:3: weight must be positive
+requests.jsonl:4: body and bodyFile cannot be used together
+requests.jsonl:5: invalid expectStatus 42
+requests.jsonl:6: header values must be a string or a list of strings
+requests.jsonl:7: json: unknown field "wieght"
+requests.jsonl:8: expected a single JSON object
+requests.jsonl:9: invalid character 'o' in literal null (expecting 'u')
+requests.jsonl:10: invalid timestamp 'today'`)
+}
+
+func TestWriteRequestsOk(t *testing.T) {
+	timestamp := time.Date(2024, 3, 1, 10, 0, 0, 500000000, time.UTC)
+	requests := []Request{
+		{
+			Method:    "POST",
+			URL:       "http://localhost:4140/items?a=<b>",
+			Header:    http.Header{"Accept": {"a", "b"}, "X-Test": {"yes"}},
+			Body:      []byte(`{"id": 1}`),
+			Weight:    1,
+			Timestamp: timestamp,
+		},
+		{Method: "GET", URL: "http://localhost:4140/", Weight: 2, ExpectStatus: 204},
+	}
+	var b strings.Builder
+	require.NoError(t, Write(&b, requests[0], ""))
+	require.NoError(t, Write(&b, requests[1], ""))
+	require.NoError(t, Write(&b, Request{Method: "PUT", URL: "http://localhost:4140/", Body: []byte{0xff}, Weight: 1}, "bodies/1.bin"))
+	assert.Equal(t, `{"method":"POST","url":"http://localhost:4140/items?a=<b>","headers":{"Accept":["a","b"],"X-Test":"yes"},"body":"{\"id\": 1}","timestamp":"2024-03-01T10:00:00.5Z"}
+{"method":"GET","url":"http://localhost:4140/","weight":2,"expectStatus":204}
+{"method":"PUT","url":"http://localhost:4140/","bodyFile":"bodies/1.bin"}
+`, b.String())
+
+	lines := strings.SplitAfter(b.String(), "\n")
+	parsed, err := Parse("requests.jsonl", strings.NewReader(lines[0]+lines[1]))
+	require.NoError(t, err)
+	assert.Equal(t, requests, parsed)
+}
+
+func TestOffsetsOk(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	requests := []Request{
+		{URL: "http://localhost:4140/b", Timestamp: start.Add(time.Second)},
+		{URL: "http://localhost:4140/a", Timestamp: start},
+		{URL: "http://localhost:4140/c", Timestamp: start.Add(1500 * time.Millisecond)},
+	}
+	sorted, offsets, err := Offsets(requests)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{0, time.Second, 1500 * time.Millisecond}, offsets)
+	assert.Equal(t, "http://localhost:4140/a", sorted[0].URL)
+	// The requests passed in are left as they were.
+	assert.Equal(t, "http://localhost:4140/b", requests[0].URL)
+
+	_, _, err = Offsets([]Request{{URL: "http://localhost:4140/", Timestamp: start}, {URL: "http://localhost:4140/"}})
+	assert.EqualError(t, err, "request 2 has no timestamp")
+}
+
+func TestParseNoRequestsOk(t *testing.T) {
+	_, err := Parse("requests.jsonl", strings.NewReader("\n\n"))
+	assert.EqualError(t, err, "requests.jsonl: the file has no requests")
+}
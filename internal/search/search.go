@@ -0,0 +1,107 @@
+package search
+
+import (
+	"fmt"
+)
+
+const (
+	// tolerance is how close, relative to the lowest failing rate, the
+	// highest passing rate must get before a bisection stops.
+	tolerance = 0.05
+	// minRate is the rate below which the search gives up.
+	minRate = 0.1
+	// maxDecreases is how many times AIMD backs off before it stops.
+	maxDecreases = 3
+)
+
+// Strategy adjusts the target rate from one reporting interval to the next
+// to find the highest rate that meets a latency and error-rate SLO.
+type Strategy interface {
+	// Rate returns the rate to run the next interval at.
+	Rate() float64
+	// Best returns the highest rate that met the SLO so far, 0 if none did.
+	Best() float64
+	// Next records whether the interval run at Rate() met the SLO, picks
+	// the next rate and reports whether the search is over.
+	Next(ok bool) bool
+}
+
+// New returns the named strategy starting at the initial rate.
+func New(name string, initial float64) (Strategy, error) {
+	if initial < minRate {
+		return nil, fmt.Errorf("the initial rate must be at least %.1f to search", minRate)
+	}
+	switch name {
+	case "bisect":
+		return &Bisect{rate: initial}, nil
+	case "aimd":
+		return &AIMD{rate: initial, increase: initial / 10}, nil
+	default:
+		return nil, fmt.Errorf("invalid search strategy '%s': expected [bisect | aimd]", name)
+	}
+}
+
+// Bisect doubles the rate until the SLO is violated and then bisects between
+// the highest passing and the lowest failing rate.
+type Bisect struct {
+	rate float64
+	low  float64
+	high float64
+}
+
+func (b *Bisect) Rate() float64 {
+	return b.rate
+}
+
+func (b *Bisect) Best() float64 {
+	return b.low
+}
+
+func (b *Bisect) Next(ok bool) bool {
+	if ok {
+		b.low = b.rate
+	} else {
+		b.high = b.rate
+	}
+
+	if b.high == 0 {
+		b.rate *= 2
+		return false
+	}
+	if b.high < minRate || (b.low > 0 && (b.high-b.low)/b.high <= tolerance) {
+		return true
+	}
+	b.rate = (b.low + b.high) / 2
+	return false
+}
+
+// AIMD increases the rate additively while the SLO is met and halves it when
+// it is violated, stopping after a few back-offs.
+type AIMD struct {
+	rate      float64
+	increase  float64
+	best      float64
+	decreases int
+}
+
+func (a *AIMD) Rate() float64 {
+	return a.rate
+}
+
+func (a *AIMD) Best() float64 {
+	return a.best
+}
+
+func (a *AIMD) Next(ok bool) bool {
+	if ok {
+		if a.rate > a.best {
+			a.best = a.rate
+		}
+		a.rate += a.increase
+		return false
+	}
+
+	a.decreases++
+	a.rate /= 2
+	return a.decreases >= maxDecreases || a.rate < minRate
+}
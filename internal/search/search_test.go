@@ -0,0 +1,45 @@
+package search
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// run drives a strategy against a service that can sustain capacity req/s.
+func run(strategy Strategy, capacity float64) (steps int) {
+	for done := false; !done && steps < 100; steps++ {
+		done = strategy.Next(strategy.Rate() <= capacity)
+	}
+	return steps
+}
+
+func TestBisectOk(t *testing.T) {
+	strategy, err := New("bisect", 100)
+	assert.NoError(t, err)
+	steps := run(strategy, 730)
+	assert.Less(t, steps, 100)
+	assert.LessOrEqual(t, strategy.Best(), 730.0)
+	assert.Greater(t, strategy.Best(), 730*(1-tolerance))
+}
+
+func TestBisectNothingPassesOk(t *testing.T) {
+	strategy, _ := New("bisect", 100)
+	steps := run(strategy, 0)
+	assert.Less(t, steps, 100)
+	assert.Equal(t, 0.0, strategy.Best())
+}
+
+func TestAIMDOk(t *testing.T) {
+	strategy, err := New("aimd", 100)
+	assert.NoError(t, err)
+	steps := run(strategy, 255)
+	assert.Less(t, steps, 100)
+	assert.Equal(t, 250.0, strategy.Best())
+}
+
+func TestNewErrorOk(t *testing.T) {
+	_, err := New("linear", 100)
+	assert.Error(t, err)
+	_, err = New("bisect", 0)
+	assert.Error(t, err)
+}
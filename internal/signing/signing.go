@@ -0,0 +1,137 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signer signs requests once their body is known. It is safe to use
+// concurrently.
+type Signer interface {
+	// Sign sets the signature of req, whose body is body, at time now.
+	Sign(req *http.Request, body []byte, now time.Time) error
+	// String describes the signer in the request info.
+	String() string
+}
+
+// DefaultParts are the parts of a request signed by HMAC unless told
+// otherwise.
+const DefaultParts = "method,path,query,timestamp,body"
+
+// HMAC signs requests with an HMAC of some of their parts, each followed by
+// a newline.
+type HMAC struct {
+	key       []byte
+	algorithm string
+	newHash   func() hash.Hash
+	parts     []string
+	header    string
+	// timestampHeader is set to the Unix time in seconds if the timestamp
+	// is signed.
+	timestampHeader string
+	encoding        string
+}
+
+// NewHMAC returns an HMAC signer. algorithm is one of sha1, sha256 or
+// sha512, and parts a comma separated list of method, path, query, host,
+// timestamp, body and header:NAME. The signature is set in header, encoded
+// in hex or base64.
+func NewHMAC(key []byte, algorithm, parts, header, timestampHeader, encoding string) (*HMAC, error) {
+	h := &HMAC{
+		key:             key,
+		algorithm:       algorithm,
+		header:          header,
+		timestampHeader: timestampHeader,
+		encoding:        encoding,
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("empty key")
+	}
+	switch algorithm {
+	case "sha1":
+		h.newHash = sha1.New
+	case "sha256":
+		h.newHash = sha256.New
+	case "sha512":
+		h.newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("unknown algorithm '%s', expected sha1, sha256 or sha512", algorithm)
+	}
+	switch encoding {
+	case "hex", "base64":
+	default:
+		return nil, fmt.Errorf("unknown encoding '%s', expected hex or base64", encoding)
+	}
+	if header == "" {
+		return nil, fmt.Errorf("empty signature header")
+	}
+	for _, part := range strings.Split(parts, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "method", part == "path", part == "query", part == "host", part == "body":
+		case part == "timestamp":
+			if timestampHeader == "" {
+				return nil, fmt.Errorf("signing the timestamp needs a timestamp header")
+			}
+		case strings.HasPrefix(part, "header:") && len(part) > len("header:"):
+		default:
+			return nil, fmt.Errorf("unknown part '%s', expected method, path, query, host, timestamp, body or header:NAME", part)
+		}
+		h.parts = append(h.parts, part)
+	}
+	return h, nil
+}
+
+func (h *HMAC) Sign(req *http.Request, body []byte, now time.Time) error {
+	mac := hmac.New(h.newHash, h.key)
+	for _, part := range h.parts {
+		switch part {
+		case "method":
+			mac.Write([]byte(req.Method))
+		case "path":
+			mac.Write([]byte(req.URL.EscapedPath()))
+		case "query":
+			mac.Write([]byte(req.URL.RawQuery))
+		case "host":
+			mac.Write([]byte(host(req)))
+		case "timestamp":
+			timestamp := strconv.FormatInt(now.Unix(), 10)
+			req.Header.Set(h.timestampHeader, timestamp)
+			mac.Write([]byte(timestamp))
+		case "body":
+			mac.Write(body)
+		default:
+			mac.Write([]byte(strings.Join(req.Header.Values(strings.TrimPrefix(part, "header:")), ",")))
+		}
+		mac.Write([]byte("\n"))
+	}
+	signature := mac.Sum(nil)
+	if h.encoding == "base64" {
+		req.Header.Set(h.header, base64.StdEncoding.EncodeToString(signature))
+	} else {
+		req.Header.Set(h.header, hex.EncodeToString(signature))
+	}
+	return nil
+}
+
+func (h *HMAC) String() string {
+	return fmt.Sprintf("HMAC-%s of %s in %s", strings.ToUpper(h.algorithm), strings.Join(h.parts, ","), h.header)
+}
+
+// host returns the Host header of req.
+func host(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
@@ -0,0 +1,88 @@
+package signing
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// exampleTime is the time of the examples of the AWS documentation.
+var exampleTime = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+func TestHMACOk(t *testing.T) {
+	h, err := NewHMAC([]byte("k3y"), "sha256", DefaultParts, "X-Signature", "X-Timestamp", "hex")
+	require.NoError(t, err)
+	req := httptest.NewRequest("POST", "http://api.test/items?q=1", nil)
+	require.NoError(t, h.Sign(req, []byte(`{"a": 1}`), time.Unix(1440938160, 0)))
+	assert.Equal(t, "1440938160", req.Header.Get("X-Timestamp"))
+	assert.Equal(t, "b827713abfccf2fabce0908b1b48cb42bd6223993bfa809637c53a69bf6e4f00", req.Header.Get("X-Signature"))
+
+	h, err = NewHMAC([]byte("k3y"), "sha1", "host,header:X-Api-Version", "Signature", "", "base64")
+	require.NoError(t, err)
+	req = httptest.NewRequest("GET", "http://api.test/", nil)
+	req.Header.Set("X-Api-Version", "v1")
+	require.NoError(t, h.Sign(req, nil, exampleTime))
+	assert.Equal(t, "ls3lGgbp5A9xHcMd40sKKvK7exg=", req.Header.Get("Signature"))
+}
+
+func TestNewHMACErrors(t *testing.T) {
+	for _, c := range []struct {
+		algorithm, parts, timestampHeader, encoding, msg string
+	}{
+		{"md5", DefaultParts, "X-Timestamp", "hex", "unknown algorithm 'md5', expected sha1, sha256 or sha512"},
+		{"sha256", "method,cookie", "X-Timestamp", "hex", "unknown part 'cookie', expected method, path, query, host, timestamp, body or header:NAME"},
+		{"sha256", "method,header:", "X-Timestamp", "hex", "unknown part 'header:', expected method, path, query, host, timestamp, body or header:NAME"},
+		{"sha256", DefaultParts, "", "hex", "signing the timestamp needs a timestamp header"},
+		{"sha256", DefaultParts, "X-Timestamp", "base32", "unknown encoding 'base32', expected hex or base64"},
+	} {
+		_, err := NewHMAC([]byte("k3y"), c.algorithm, c.parts, "X-Signature", c.timestampHeader, c.encoding)
+		assert.EqualError(t, err, c.msg)
+	}
+}
+
+func TestSigV4GetVanilla(t *testing.T) {
+	s, err := NewSigV4("service", "us-east-1", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "")
+	require.NoError(t, err)
+	req := httptest.NewRequest("GET", "http://example.amazonaws.com/", nil)
+	require.NoError(t, s.Sign(req, nil, exampleTime))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestSigV4ListUsers(t *testing.T) {
+	s, err := NewSigV4("iam", "us-east-1", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "")
+	require.NoError(t, err)
+	req := httptest.NewRequest("GET", "https://iam.amazonaws.com/?Version=2010-05-08&Action=ListUsers", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	require.NoError(t, s.Sign(req, nil, exampleTime))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		req.Header.Get("Authorization"))
+}
+
+func TestSigV4CanonicalURI(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://a.test/documents%20and%20settings/a=b", nil)
+	assert.Equal(t, "/documents%2520and%2520settings/a%253Db", (&SigV4{service: "execute-api"}).canonicalURI(req))
+	assert.Equal(t, "/documents%20and%20settings/a%3Db", (&SigV4{service: "s3"}).canonicalURI(req))
+}
+
+func TestSigV4CanonicalQuery(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://a.test/?a-b=2&b=1&a=3&a=1&c=d%20e", nil)
+	assert.Equal(t, "a=1&a=3&a-b=2&b=1&c=d%20e", canonicalQuery(req))
+}
+
+func TestSigV4QueryOrderValue(t *testing.T) {
+	// get-vanilla-query-order-value of the AWS Signature Version 4 test
+	// suite: the values of a repeated key are sorted too.
+	s, err := NewSigV4("service", "us-east-1", "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "")
+	require.NoError(t, err)
+	req := httptest.NewRequest("GET", "http://example.amazonaws.com/?Param1=value2&Param1=value1", nil)
+	require.NoError(t, s.Sign(req, nil, exampleTime))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5772eed61e12b33fae39ee5e7012498b51d56abc0abb7c60486157bd471c4694",
+		req.Header.Get("Authorization"))
+}
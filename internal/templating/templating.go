@@ -0,0 +1,143 @@
+package templating
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+// Vars are the variables of a request that templates can refer to, e.g.
+// {{.RequestID}}.
+type Vars struct {
+	// RequestID is the ID sent in the Sc-Req-Id header.
+	RequestID uint64
+	// WorkerID is the index of the request thread, starting at 0.
+	WorkerID int
+	// Iteration is the reporting interval the request is sent in.
+	Iteration uint64
+	// Row is the row of the -feeder file picked for the request, by column
+	// name, e.g. {{.Row.user_id}}.
+	Row map[string]string
+	// Values are the values extracted by the previous steps of a -flow, by
+	// name, e.g. {{.Values.token}}.
+	Values map[string]string
+}
+
+// Template is a URL, header value or body that is rendered for every request.
+// Text without placeholders is returned as is.
+type Template struct {
+	text     string
+	template *template.Template
+}
+
+var counters sync.Map
+
+var funcs = template.FuncMap{
+	"randInt":    randInt,
+	"randString": randString,
+	"uuid":       uuid,
+	"now":        time.Now,
+	"timestamp":  timestamp,
+	"counter":    counter,
+}
+
+// Parse parses text, which may refer to the variables of Vars, the given
+// columns of Row and the given Values, and call the following functions:
+//
+//	randInt MIN MAX  a random integer between MIN and MAX included
+//	randString N     N random letters and digits
+//	uuid             a random version 4 UUID
+//	now              the current time, e.g. {{now.Format "2006-01-02"}}
+//	timestamp        the current Unix time in milliseconds
+//	counter NAME     increments the counter NAME, shared by all requests, and
+//	                 returns it, starting at 1
+func Parse(name string, text string, columns []string, values []string) (*Template, error) {
+	if !strings.Contains(text, "{{") {
+		return &Template{text: text}, nil
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Render once without side effects to catch unknown variables and
+	// invalid arguments before sending anything.
+	check := template.Must(tmpl.Clone()).Funcs(template.FuncMap{
+		"counter": func(string) uint64 { return 0 },
+	})
+	if err := check.Execute(io.Discard, Vars{Row: blank(columns), Values: blank(values)}); err != nil {
+		return nil, err
+	}
+	return &Template{text: text, template: tmpl}, nil
+}
+
+// blank maps the given names to empty strings.
+func blank(names []string) map[string]string {
+	m := make(map[string]string, len(names))
+	for _, name := range names {
+		m[name] = ""
+	}
+	return m
+}
+
+// MustParse is like Parse but panics if text can't be parsed.
+func MustParse(name string, text string, columns []string, values []string) *Template {
+	tmpl, err := Parse(name, text, columns, values)
+	if err != nil {
+		panic(err)
+	}
+	return tmpl
+}
+
+// Render renders the template for a request.
+func (t *Template) Render(vars Vars) (string, error) {
+	if t.template == nil {
+		return t.text, nil
+	}
+	var b strings.Builder
+	if err := t.template.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func randInt(min, max int) (int, error) {
+	if max < min {
+		return 0, fmt.Errorf("randInt: %d is less than %d", max, min)
+	}
+	return min + mathrand.Intn(max-min+1), nil
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func randString(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[mathrand.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+func uuid() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func timestamp() int64 {
+	return time.Now().UnixMilli()
+}
+
+func counter(name string) uint64 {
+	value, _ := counters.LoadOrStore(name, new(uint64))
+	return atomic.AddUint64(value.(*uint64), 1)
+}
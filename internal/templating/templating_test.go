@@ -0,0 +1,82 @@
+package templating
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func render(t *testing.T, text string, vars Vars) string {
+	tmpl, err := Parse("test", text, nil, nil)
+	require.NoError(t, err)
+	rendered, err := tmpl.Render(vars)
+	require.NoError(t, err)
+	return rendered
+}
+
+func TestRenderWithoutPlaceholders(t *testing.T) {
+	assert.Equal(t, `{"a": 1}`, render(t, `{"a": 1}`, Vars{}))
+}
+
+func TestRenderVars(t *testing.T) {
+	vars := Vars{RequestID: 42, WorkerID: 3, Iteration: 7}
+	assert.Equal(t, "/42/3/7", render(t, "/{{.RequestID}}/{{.WorkerID}}/{{.Iteration}}", vars))
+}
+
+func TestRenderRow(t *testing.T) {
+	tmpl, err := Parse("test", `/users/{{.Row.user_id}}?sku={{index .Row "sku-code"}}`, []string{"user_id", "sku-code"}, nil)
+	require.NoError(t, err)
+	rendered, err := tmpl.Render(Vars{Row: map[string]string{"user_id": "42", "sku-code": "A1"}})
+	require.NoError(t, err)
+	assert.Equal(t, "/users/42?sku=A1", rendered)
+}
+
+func TestRenderRandom(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		n, err := strconv.Atoi(render(t, "{{randInt 1 3}}", Vars{}))
+		require.NoError(t, err)
+		assert.True(t, n >= 1 && n <= 3, n)
+	}
+	assert.Regexp(t, `^[a-zA-Z0-9]{12}$`, render(t, "{{randString 12}}", Vars{}))
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, render(t, "{{uuid}}", Vars{}))
+}
+
+func TestRenderTime(t *testing.T) {
+	assert.Equal(t, time.Now().Format("2006"), render(t, `{{now.Format "2006"}}`, Vars{}))
+	ms, err := strconv.ParseInt(render(t, "{{timestamp}}", Vars{}), 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().UnixMilli(), ms, 1000)
+}
+
+func TestCountersAreSharedAndNotIncrementedByParse(t *testing.T) {
+	first, err := Parse("first", `{{counter "TestCounters"}}`, nil, nil)
+	require.NoError(t, err)
+	second, err := Parse("second", `{{counter "TestCounters"}}`, nil, nil)
+	require.NoError(t, err)
+
+	rendered, err := first.Render(Vars{})
+	require.NoError(t, err)
+	assert.Equal(t, "1", rendered)
+	rendered, err = second.Render(Vars{})
+	require.NoError(t, err)
+	assert.Equal(t, "2", rendered)
+	assert.Equal(t, "1", render(t, `{{counter "TestCountersOther"}}`, Vars{}))
+}
+
+func TestParseErrors(t *testing.T) {
+	for text, want := range map[string]string{
+		"{{.Foo}}":        "can't evaluate field Foo",
+		"{{nope}}":        `function "nope" not defined`,
+		"{{randInt 5 1}}": "randInt: 1 is less than 5",
+		"{{.RequestID":    "unclosed action",
+		"{{.Row.sku}}":    `map has no entry for key "sku"`,
+	} {
+		_, err := Parse("test", text, []string{"user_id"}, nil)
+		if assert.Error(t, err, text) {
+			assert.Regexp(t, regexp.QuoteMeta(want), err.Error())
+		}
+	}
+}
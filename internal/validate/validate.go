@@ -0,0 +1,92 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Validator collects the problems found in a YAML (or JSON) file so that they
+// are reported together, each prefixed with the file name and line number it
+// was found on.
+type Validator struct {
+	name   string
+	errors []error
+}
+
+// New returns a Validator for the named file.
+func New(name string) *Validator {
+	return &Validator{name: name}
+}
+
+// Fail records a problem found at node.
+func (v *Validator) Fail(node *yaml.Node, msg string, args ...interface{}) {
+	v.errors = append(v.errors, fmt.Errorf("%s:%d: %s", v.name, node.Line, fmt.Sprintf(msg, args...)))
+}
+
+// Err returns the problems found so far, or nil if there are none.
+func (v *Validator) Err() error {
+	return errors.Join(v.errors...)
+}
+
+// Decode decodes node, described as what in errors, into out. It reports
+// whether it succeeded; node must be a mapping.
+func (v *Validator) Decode(node *yaml.Node, what string, out interface{}) bool {
+	if node.Kind != yaml.MappingNode {
+		v.Fail(node, "%s: expected a mapping", what)
+		return false
+	}
+	if err := node.Decode(out); err != nil {
+		v.errors = append(v.errors, fmt.Errorf("%s: %s: %s", v.name, what, err))
+		return false
+	}
+	return true
+}
+
+// CheckFields records the keys of a mapping node that aren't known.
+func (v *Validator) CheckFields(node *yaml.Node, what string, known []string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		found := false
+		for _, name := range known {
+			if key.Value == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.Fail(key, "%s: unknown field '%s'", what, key.Value)
+		}
+	}
+}
+
+// Field returns the value node of key in a mapping node, or nil.
+func Field(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// URL returns the normalized form of a URL to send requests to, or an error
+// if it has no scheme or host. URLs holding templates are returned as they
+// are: templates are checked separately.
+func URL(rawURL string) (string, error) {
+	if strings.Contains(rawURL, "{{") {
+		return rawURL, nil
+	}
+	URL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL '%s': %s", rawURL, err)
+	} else if URL.Scheme == "" {
+		return "", fmt.Errorf("invalid URL '%s': Missing scheme", rawURL)
+	} else if URL.Host == "" {
+		return "", fmt.Errorf("invalid URL '%s': Missing host", rawURL)
+	}
+	return URL.String(), nil
+}
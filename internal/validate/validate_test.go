@@ -0,0 +1,44 @@
+package validate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"testing"
+)
+
+func TestValidatorOk(t *testing.T) {
+	var document yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte("name: a\nrate: x\nbogus: 1\n"), &document))
+	root := document.Content[0]
+
+	v := New("plan.yaml")
+	var raw struct {
+		Name string `yaml:"name"`
+	}
+	assert.True(t, v.Decode(root, "stage 1", &raw))
+	assert.Equal(t, "a", raw.Name)
+	assert.NoError(t, v.Err())
+
+	v.CheckFields(root, "stage 1", []string{"name", "rate"})
+	assert.Equal(t, "x", Field(root, "rate").Value)
+	assert.Nil(t, Field(root, "urls"))
+	assert.False(t, v.Decode(Field(root, "rate"), "rate", &raw))
+	assert.EqualError(t, v.Err(), "plan.yaml:3: stage 1: unknown field 'bogus'\nplan.yaml:2: rate: expected a mapping")
+}
+
+func TestURLOk(t *testing.T) {
+	normalized, err := URL("http://localhost:4140/a b")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:4140/a%20b", normalized)
+
+	// Templates are left to be checked when they are parsed.
+	normalized, err = URL("{{.Row.url}}")
+	require.NoError(t, err)
+	assert.Equal(t, "{{.Row.url}}", normalized)
+
+	_, err = URL("localhost:4140/")
+	assert.EqualError(t, err, "invalid URL 'localhost:4140/': Missing host")
+	_, err = URL("/path")
+	assert.EqualError(t, err, "invalid URL '/path': Missing scheme")
+}
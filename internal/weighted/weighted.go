@@ -0,0 +1,65 @@
+package weighted
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Chooser picks indexes at random in proportion to their weights.
+type Chooser struct {
+	// cumulative holds the running sum of the weights.
+	cumulative []float64
+}
+
+// New returns a Chooser of the indexes of weights, which must be positive.
+func New(weights []float64) *Chooser {
+	cumulative := make([]float64, len(weights))
+	total := 0.0
+	for i, weight := range weights {
+		total += weight
+		cumulative[i] = total
+	}
+	return &Chooser{cumulative: cumulative}
+}
+
+// Pick returns an index at random. It is safe to call concurrently.
+func (c *Chooser) Pick() int {
+	return c.pick(rand.Float64())
+}
+
+// pick returns the index that x, in [0, 1), falls on.
+func (c *Chooser) pick(x float64) int {
+	target := x * c.cumulative[len(c.cumulative)-1]
+	i := sort.Search(len(c.cumulative), func(i int) bool {
+		return c.cumulative[i] > target
+	})
+	// Rounding may push the last index out of range.
+	if i == len(c.cumulative) {
+		i--
+	}
+	return i
+}
+
+// ParseList parses a comma separated list of NAME or NAME=WEIGHT items,
+// where the weight defaults to 1.
+func ParseList(list string) ([]string, []float64, error) {
+	var names []string
+	var weights []float64
+	for _, item := range strings.Split(list, ",") {
+		name, weight := item, 1.0
+		if i := strings.LastIndex(item, "="); i >= 0 {
+			var err error
+			name = item[:i]
+			weight, err = strconv.ParseFloat(item[i+1:], 64)
+			if err != nil || weight <= 0 {
+				return nil, nil, fmt.Errorf("invalid weight in '%s': must be a positive number", item)
+			}
+		}
+		names = append(names, name)
+		weights = append(weights, weight)
+	}
+	return names, weights, nil
+}
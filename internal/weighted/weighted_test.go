@@ -0,0 +1,50 @@
+package weighted
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPickOk(t *testing.T) {
+	chooser := New([]float64{70, 25, 5})
+	assert.Equal(t, 0, chooser.pick(0))
+	assert.Equal(t, 0, chooser.pick(0.699))
+	assert.Equal(t, 1, chooser.pick(0.7))
+	assert.Equal(t, 1, chooser.pick(0.949))
+	assert.Equal(t, 2, chooser.pick(0.95))
+	assert.Equal(t, 2, chooser.pick(0.9999999999))
+}
+
+func TestPickSingleOk(t *testing.T) {
+	chooser := New([]float64{0.5})
+	assert.Equal(t, 0, chooser.pick(0))
+	assert.Equal(t, 0, chooser.pick(0.99))
+}
+
+func TestPickDistributionOk(t *testing.T) {
+	chooser := New([]float64{1, 3})
+	counts := make([]int, 2)
+	for i := 0; i < 10000; i++ {
+		counts[chooser.Pick()]++
+	}
+	assert.InDelta(t, 7500, counts[1], 300)
+}
+
+func TestParseListOk(t *testing.T) {
+	names, weights, err := ParseList("web_a=1,web_b=2.5,web_c")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web_a", "web_b", "web_c"}, names)
+	assert.Equal(t, []float64{1, 2.5, 1}, weights)
+
+	names, weights, err = ParseList("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, names)
+	assert.Equal(t, []float64{1}, weights)
+}
+
+func TestParseListErrorsOk(t *testing.T) {
+	_, _, err := ParseList("web_a=1,web_b=heavy")
+	assert.EqualError(t, err, "invalid weight in 'web_b=heavy': must be a positive number")
+	_, _, err = ParseList("web_a=0")
+	assert.EqualError(t, err, "invalid weight in 'web_a=0': must be a positive number")
+}